@@ -1,13 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"io"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
-	"blockchain-go/internal/blockchain"
 	"blockchain-go/internal/config"
-	"blockchain-go/internal/miner"
-	"blockchain-go/internal/network"
+	"blockchain-go/internal/node"
 )
 
 func main() {
@@ -17,6 +27,8 @@ func main() {
 		initHost   = flag.String("init-host", "", "Initial peer host for joining network")
 		initPort   = flag.Int("init-port", 0, "Initial peer port for joining network")
 		port       = flag.Int("port", 8080, "Port to listen on")
+		identity   = flag.String("identity", "", "Path to the node identity key file")
+		regtest    = flag.Bool("regtest", false, "Run a regtest chain with a trivial fixed difficulty and no background miner")
 	)
 	flag.Parse()
 
@@ -32,25 +44,86 @@ func main() {
 		cfg.Network.Port = *port
 	}
 
-	// Create blockchain instance
-	bc := blockchain.New(cfg.Blockchain.DifficultyCalculationBlocks, cfg.Blockchain.TargetBlockTime)
+	// Override identity file if specified
+	if *identity != "" {
+		cfg.Network.IdentityFile = *identity
+	}
+
+	if *regtest {
+		cfg.Blockchain.Regtest = true
+	}
+
+	// Ask the running node to mine blocks instead of starting a node
+	if flag.Arg(0) == "generate" {
+		if err := runGenerate(cfg.API, flag.Args()[1:]); err != nil {
+			log.Fatalf("Failed to generate blocks: %v", err)
+		}
+		return
+	}
+
+	// Stop the node cleanly on Ctrl-C or when the process is terminated
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	n, err := node.New(cfg, *initHost, *initPort)
+	if err != nil {
+		log.Fatalf("Failed to start node: %v", err)
+	}
+
+	if err := n.Run(ctx); err != nil {
+		log.Fatalf("Failed to stop node cleanly: %v", err)
+	}
+}
+
+// generateTimeout is the time given to the node to mine the requested blocks
+const generateTimeout = 5 * time.Minute
+
+// runGenerate asks the node behind the configured admin API to mine blocks,
+// with the arguments N [address], and prints their hashes
+func runGenerate(cfg config.APIConfig, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("usage: generate N [address]")
+	}
+
+	count, err := strconv.Atoi(args[0])
+	if err != nil || count < 1 {
+		return fmt.Errorf("invalid number of blocks %q", args[0])
+	}
+
+	request := map[string]interface{}{"blocks": count}
+	if len(args) == 2 {
+		request["address"] = args[1]
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
 
-	// Create network manager
-	var nm *network.Manager
-	if *initHost != "" && *initPort != 0 {
-		// Join existing network
-		nm = network.NewJoiningManager(cfg.Network, bc, *initHost, *initPort)
-	} else {
-		// Create genesis block and start new network
-		genesisBlock := bc.CreateGenesisBlock()
-		log.Printf("Created genesis block: %s", genesisBlock.Hash)
-		nm = network.NewManager(cfg.Network, bc)
+	url := "http://" + net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)) + "/generate"
+	client := &http.Client{Timeout: generateTimeout}
+	response, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
 	}
+	defer response.Body.Close()
 
-	// Start network server
-	go nm.StartServer()
-	log.Printf("P2P Network started on port %d", cfg.Network.Port)
+	var result struct {
+		Hashes []string `json:"hashes"`
+		Error  string   `json:"error"`
+	}
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("node answered %s", response.Status)
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("node answered %s: %s", response.Status, result.Error)
+	}
 
-	// Start mining
-	miner.Start(nm, cfg.Miner)
+	for _, hash := range result.Hashes {
+		fmt.Println(hash)
+	}
+	return nil
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"blockchain-go/internal/blockchain"
+	"blockchain-go/internal/config"
+	"blockchain-go/internal/miner"
+	"blockchain-go/internal/pool"
+)
+
+func main() {
+	// Parse command line flags
+	var (
+		node     = flag.String("node", "http://127.0.0.1:9080", "Base URL of the admin API of the node to mine for")
+		workers  = flag.Int("workers", 0, "Number of mining goroutines (0 uses one per CPU)")
+		maxNonce = flag.Int("max-nonce", blockchain.DefaultMaxNonce, "Size of the nonce space")
+		refresh  = flag.Int("refresh", 1, "Interval in seconds between two block template requests")
+		duty     = flag.Int("duty-cycle", 100, "Percentage of the time spent hashing, from 1 to 100")
+		poolAddr = flag.String("pool", "", "Address (host:port) of a mining pool to mine for instead of a node")
+		worker   = flag.String("worker", "miner", "Worker name the shares are credited to by the pool")
+	)
+	flag.Parse()
+
+	cfg := config.MinerConfig{
+		Enabled:             true,
+		NetworkSyncInterval: *refresh,
+		MaxNonce:            *maxNonce,
+		Workers:             *workers,
+		DutyCycle:           *duty,
+	}
+
+	// Stop cleanly on Ctrl-C or when the process is terminated
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var source miner.WorkSource
+	var sessionDone <-chan struct{}
+	if *poolAddr != "" {
+		client, err := pool.Dial(*poolAddr, *worker)
+		if err != nil {
+			log.Fatalf("Failed to join mining pool: %v", err)
+		}
+		defer client.Close()
+
+		log.Printf("Mining for the pool at %s as %s", *poolAddr, *worker)
+		source = client
+		sessionDone = client.Done()
+	} else {
+		log.Printf("Mining for the node at %s", *node)
+		source = miner.NewRemoteWorkSource(*node)
+	}
+
+	m := miner.NewMinerWithSource(source, cfg)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Start()
+	}()
+
+	// Also stop when the pool closes the session
+	select {
+	case <-ctx.Done():
+	case <-sessionDone:
+		log.Printf("Mining pool closed the session")
+	}
+	m.Stop()
+	<-done
+}
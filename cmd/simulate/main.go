@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"blockchain-go/internal/simulator"
+)
+
+func main() {
+	// Parse command line flags
+	var (
+		nodes     = flag.Int("nodes", 5, "Number of simulated nodes")
+		seed      = flag.Int64("seed", 1, "Random seed of the simulation")
+		duration  = flag.Duration("duration", 10*time.Minute, "Virtual duration of the mining phase")
+		settle    = flag.Duration("settle", 5*time.Minute, "Maximum virtual duration of the convergence phase")
+		blockTime = flag.Duration("block-time", 20*time.Second, "Target block time")
+		latency   = flag.Duration("latency", 200*time.Millisecond, "Mean message latency")
+		jitter    = flag.Duration("jitter", 100*time.Millisecond, "Message latency jitter")
+		loss      = flag.Float64("loss", 0, "Probability of losing a message")
+		degree    = flag.Int("degree", 3, "Number of peers contacted when joining")
+		partition = flag.Bool("partition", false, "Split the network in two halves during the second quarter")
+		crash     = flag.Bool("crash", false, "Crash the last node during the second quarter")
+		lateJoin  = flag.Bool("late-join", false, "Make the last node join at mid-simulation")
+		selfish   = flag.Float64("selfish", 0, "Hash power share of a selfish miner run by the second node")
+		verbose   = flag.Bool("verbose", false, "Show the logs of the nodes")
+	)
+	flag.Parse()
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	if *nodes < 1 {
+		fmt.Fprintln(os.Stderr, "At least one node is required")
+		os.Exit(2)
+	}
+
+	cfg := simulator.DefaultConfig()
+	cfg.Seed = *seed
+	cfg.Duration = *duration
+	cfg.SettleDuration = *settle
+	cfg.TargetBlockTime = *blockTime
+	cfg.Latency = *latency
+	cfg.LatencyJitter = *jitter
+	cfg.PacketLoss = *loss
+	cfg.Degree = *degree
+
+	// Honest nodes share the hash power not held by the selfish miner
+	specs := make([]simulator.NodeSpec, *nodes)
+	for i := range specs {
+		specs[i] = simulator.NodeSpec{HashPower: 1}
+	}
+
+	if *selfish > 0 && *selfish < 1 && *nodes > 1 {
+		honestPower := (1 - *selfish) / float64(*nodes-1)
+		for i := range specs {
+			specs[i].HashPower = honestPower
+		}
+		specs[1] = simulator.NodeSpec{HashPower: *selfish, Selfish: true}
+	}
+
+	last := *nodes - 1
+	if *lateJoin && last > 0 {
+		specs[last].JoinAt = *duration / 2
+	}
+
+	sim, err := simulator.New(cfg, specs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create simulation: %v\n", err)
+		os.Exit(2)
+	}
+
+	// Fault injection scenarios
+	if *partition && *nodes > 1 {
+		groups := [][]int{make([]int, 0), make([]int, 0)}
+		for i := 0; i < *nodes; i++ {
+			groups[i*2 / *nodes] = append(groups[i*2 / *nodes], i)
+		}
+
+		sim.Schedule(*duration/4, "partition", func(s *simulator.Simulation) { s.Partition(groups...) })
+		sim.Schedule(*duration/2, "heal", func(s *simulator.Simulation) { s.Heal() })
+	}
+
+	if *crash && last > 0 {
+		sim.Schedule(*duration/4, "crash", func(s *simulator.Simulation) { s.Crash(last) })
+		sim.Schedule(*duration/2, "recover", func(s *simulator.Simulation) { s.Recover(last) })
+	}
+
+	start := time.Now()
+	report, err := sim.Run()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Simulation failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Print(report.String())
+	fmt.Printf("Simulated %s in %s\n", *duration, time.Since(start).Round(time.Millisecond))
+
+	if err := report.AssertConvergence(); err != nil {
+		fmt.Fprintf(os.Stderr, "Convergence check failed: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// banRequest is the body of a ban creation request
+type banRequest struct {
+	Address  string `json:"address"`
+	Duration int    `json:"duration"`
+	Reason   string `json:"reason"`
+}
+
+// handleListBans lists the active bans
+func (s *Server) handleListBans(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.networkManager.GetBanManager().List())
+}
+
+// handleAddBan bans an address for the requested duration in seconds
+func (s *Server) handleAddBan(w http.ResponseWriter, r *http.Request) {
+	var request banRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to decode ban request: %w", err))
+		return
+	}
+
+	if request.Reason == "" {
+		request.Reason = "manual ban"
+	}
+
+	duration := time.Duration(request.Duration) * time.Second
+	if err := s.networkManager.GetBanManager().Ban(request.Address, duration, request.Reason); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.networkManager.RemovePeersByHost(request.Address)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleLiftBan lifts the ban of an address
+func (s *Server) handleLiftBan(w http.ResponseWriter, r *http.Request) {
+	if err := s.networkManager.GetBanManager().Unban(r.PathValue("address")); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
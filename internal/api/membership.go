@@ -0,0 +1,53 @@
+package api
+
+import (
+	"blockchain-go/internal/blockchain"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// membershipResponse describes the membership of a permissioned network
+type membershipResponse struct {
+	Permissioned bool                          `json:"permissioned"`
+	Members      []string                      `json:"members"`
+	Producers    []string                      `json:"producers"`
+	Pending      []blockchain.MembershipUpdate `json:"pending"`
+}
+
+// handleGetMembership returns the current membership and the pending updates
+func (s *Server) handleGetMembership(w http.ResponseWriter, r *http.Request) {
+	bc := s.networkManager.GetBlockchain()
+
+	response := membershipResponse{
+		Members:   []string{},
+		Producers: []string{},
+		Pending:   []blockchain.MembershipUpdate{},
+	}
+
+	if membership := bc.GetMembership(); membership != nil {
+		response.Permissioned = true
+		response.Members = membership.Members()
+		response.Producers = membership.Producers()
+		response.Pending = bc.PendingMembershipUpdates()
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleProposeMembership queues a membership update, recorded on chain in the
+// next block produced by this node
+func (s *Server) handleProposeMembership(w http.ResponseWriter, r *http.Request) {
+	var update blockchain.MembershipUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to decode membership update: %w", err))
+		return
+	}
+
+	if err := s.networkManager.GetBlockchain().ProposeMembershipUpdate(update); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"blockchain-go/internal/blockchain"
+	"blockchain-go/internal/miner"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// maxGenerateBlocks is the maximum number of blocks generated by a request
+const maxGenerateBlocks = 1000
+
+// generateRequest asks for blocks to be mined on demand
+type generateRequest struct {
+	Blocks  int    `json:"blocks"`
+	Address string `json:"address,omitempty"`
+}
+
+// generateResponse lists the hashes of the generated blocks
+type generateResponse struct {
+	Hashes []string `json:"hashes"`
+}
+
+// miningSettings changes the settings of the miner, unset fields are kept
+type miningSettings struct {
+	Workers   *int `json:"workers"`
+	DutyCycle *int `json:"duty_cycle"`
+}
+
+// submitResponse is the answer to an accepted block
+type submitResponse struct {
+	Index int    `json:"index"`
+	Hash  string `json:"hash"`
+}
+
+// handleGetBlockTemplate returns a template of the next block to mine
+func (s *Server) handleGetBlockTemplate(w http.ResponseWriter, r *http.Request) {
+	template, err := s.workSource.GetBlockTemplate()
+	if errors.Is(err, miner.ErrNotProducer) {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, template)
+}
+
+// handleSubmitBlock adds a block solved from a template to the chain
+func (s *Server) handleSubmitBlock(w http.ResponseWriter, r *http.Request) {
+	var block blockchain.Block
+	if err := json.NewDecoder(r.Body).Decode(&block); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to decode block: %w", err))
+		return
+	}
+
+	if err := s.workSource.SubmitBlock(&block); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, miner.ErrStaleBlock) {
+			status = http.StatusConflict
+		}
+		writeError(w, status, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, submitResponse{Index: block.Index, Hash: block.Hash})
+}
+
+// handlePoolWorkers lists the share statistics of the workers of the mining pool
+func (s *Server) handlePoolWorkers(w http.ResponseWriter, r *http.Request) {
+	if s.pool == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("mining pool is not enabled"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.pool.Stats())
+}
+
+// handleGenerate mines the requested number of blocks synchronously, only on
+// chains with a fixed difficulty such as regtest chains
+func (s *Server) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	if s.networkManager.GetBlockchain().GetFixedDifficulty() == 0 {
+		writeError(w, http.StatusForbidden, fmt.Errorf("generate is only available in regtest mode"))
+		return
+	}
+
+	var request generateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to decode generate request: %w", err))
+		return
+	}
+
+	if request.Blocks < 1 || request.Blocks > maxGenerateBlocks {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("blocks must be between 1 and %d", maxGenerateBlocks))
+		return
+	}
+
+	hashes, err := miner.Generate(s.workSource, request.Blocks, request.Address)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("generated %d blocks: %w", len(hashes), err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, generateResponse{Hashes: hashes})
+}
+
+// handleMiningStatus returns the state of the miner and the template it is mining
+func (s *Server) handleMiningStatus(w http.ResponseWriter, r *http.Request) {
+	if s.miner == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("node has no miner"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.miner.Status())
+}
+
+// handleStartMining resumes mining
+func (s *Server) handleStartMining(w http.ResponseWriter, r *http.Request) {
+	if s.miner == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("node has no miner"))
+		return
+	}
+
+	s.miner.Resume()
+	writeJSON(w, http.StatusOK, s.miner.Status())
+}
+
+// handleStopMining pauses mining, the node keeps serving its peers
+func (s *Server) handleStopMining(w http.ResponseWriter, r *http.Request) {
+	if s.miner == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("node has no miner"))
+		return
+	}
+
+	s.miner.Pause()
+	writeJSON(w, http.StatusOK, s.miner.Status())
+}
+
+// handleMiningSettings changes the number of workers and the duty cycle of the miner
+func (s *Server) handleMiningSettings(w http.ResponseWriter, r *http.Request) {
+	if s.miner == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("node has no miner"))
+		return
+	}
+
+	var settings miningSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to decode mining settings: %w", err))
+		return
+	}
+
+	if settings.DutyCycle != nil {
+		if err := s.miner.SetDutyCycle(*settings.DutyCycle); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	if settings.Workers != nil {
+		if err := s.miner.SetWorkers(*settings.Workers); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, s.miner.Status())
+}
+
+// handleMiningStats returns the hash rates over sliding windows, the blocks
+// found, stale and orphaned, and the estimated network hash rate
+func (s *Server) handleMiningStats(w http.ResponseWriter, r *http.Request) {
+	if s.miner == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("node has no miner"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.miner.Stats(s.networkManager.GetBlockchain()))
+}
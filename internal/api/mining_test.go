@@ -0,0 +1,96 @@
+package api
+
+import (
+	"blockchain-go/internal/blockchain"
+	"blockchain-go/internal/config"
+	"blockchain-go/internal/network"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Every generated block is logged
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newTestServer returns the admin API of a node that is not listening, on a
+// regtest chain or on a chain of adjusted difficulty
+func newTestServer(regtest bool) (*Server, *blockchain.Blockchain) {
+	cfg := config.Default()
+	cfg.Network.BanFile = ""
+	cfg.Network.IdentityFile = ""
+
+	bc := blockchain.New(cfg.Blockchain.DifficultyCalculationBlocks, cfg.Blockchain.TargetBlockTime)
+	if regtest {
+		bc.SetFixedDifficulty(blockchain.RegtestDifficulty)
+	}
+	bc.CreateGenesisBlock()
+
+	nm := network.NewManagerWithTransport(cfg.Network, bc, network.NewMemoryNetwork().Transport("10.0.0.1"))
+	return NewServer(cfg.API, nm), bc
+}
+
+// generate posts a generate request to the API
+func generate(s *Server, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	s.mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(body)))
+	return recorder
+}
+
+func TestGenerate(t *testing.T) {
+	s, bc := newTestServer(true)
+
+	recorder := generate(s, `{"blocks": 3, "address": "alice"}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("generate answered %d: %s", recorder.Code, recorder.Body)
+	}
+
+	var response generateResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(response.Hashes) != 3 || bc.GetChainLength() != 4 {
+		t.Fatalf("generated %d hashes and a chain of %d blocks, want 3 and 4", len(response.Hashes), bc.GetChainLength())
+	}
+
+	for i, hash := range response.Hashes {
+		block, err := bc.GetBlock(i + 1)
+		if err != nil || block.Hash != hash || block.Data != "alice" {
+			t.Fatalf("block #%d does not match the generated hash and address", i+1)
+		}
+	}
+}
+
+func TestGenerateRejected(t *testing.T) {
+	regtest, _ := newTestServer(true)
+	adjusted, bc := newTestServer(false)
+
+	tests := []struct {
+		name   string
+		server *Server
+		body   string
+		code   int
+	}{
+		{"adjusted difficulty", adjusted, `{"blocks": 1}`, http.StatusForbidden},
+		{"no blocks", regtest, `{"blocks": 0}`, http.StatusBadRequest},
+		{"too many blocks", regtest, `{"blocks": 1001}`, http.StatusBadRequest},
+		{"malformed request", regtest, `{"blocks": "one"}`, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		if recorder := generate(test.server, test.body); recorder.Code != test.code {
+			t.Errorf("%s: generate answered %d, want %d", test.name, recorder.Code, test.code)
+		}
+	}
+
+	if length := bc.GetChainLength(); length != 1 {
+		t.Fatalf("chain of adjusted difficulty grew to %d blocks", length)
+	}
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"blockchain-go/internal/config"
+	"blockchain-go/internal/miner"
+	"blockchain-go/internal/network"
+	"blockchain-go/internal/pool"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// Server exposes the node's admin API over HTTP
+type Server struct {
+	networkManager *network.Manager
+	workSource     miner.WorkSource
+	miner          *miner.Miner
+	pool           *pool.Server
+	config         config.APIConfig
+	mux            *http.ServeMux
+	server         *http.Server
+}
+
+// NewServer creates a new admin API server
+func NewServer(cfg config.APIConfig, nm *network.Manager) *Server {
+	s := &Server{
+		networkManager: nm,
+		workSource:     miner.NewLocalWorkSource(nm),
+		config:         cfg,
+		mux:            http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("GET /peers", s.handleListPeers)
+	s.mux.HandleFunc("GET /bans", s.handleListBans)
+	s.mux.HandleFunc("POST /bans", s.handleAddBan)
+	s.mux.HandleFunc("DELETE /bans/{address}", s.handleLiftBan)
+	s.mux.HandleFunc("GET /stats/broadcast", s.handleBroadcastStats)
+	s.mux.HandleFunc("GET /stats/bandwidth", s.handleBandwidthStats)
+	s.mux.HandleFunc("GET /membership", s.handleGetMembership)
+	s.mux.HandleFunc("POST /membership", s.handleProposeMembership)
+	s.mux.HandleFunc("GET /mining/template", s.handleGetBlockTemplate)
+	s.mux.HandleFunc("POST /mining/submit", s.handleSubmitBlock)
+	s.mux.HandleFunc("GET /mining/status", s.handleMiningStatus)
+	s.mux.HandleFunc("GET /mining/stats", s.handleMiningStats)
+	s.mux.HandleFunc("POST /mining/start", s.handleStartMining)
+	s.mux.HandleFunc("POST /mining/stop", s.handleStopMining)
+	s.mux.HandleFunc("POST /mining/settings", s.handleMiningSettings)
+	s.mux.HandleFunc("GET /pool/workers", s.handlePoolWorkers)
+	s.mux.HandleFunc("POST /generate", s.handleGenerate)
+
+	s.server = &http.Server{
+		Addr:    cfg.Host + ":" + strconv.Itoa(cfg.Port),
+		Handler: s.mux,
+	}
+
+	return s
+}
+
+// SetMiner exposes the controls of the miner of the node
+func (s *Server) SetMiner(m *miner.Miner) {
+	s.miner = m
+}
+
+// SetPool exposes the statistics of the mining pool of the node
+func (s *Server) SetPool(p *pool.Server) {
+	s.pool = p
+}
+
+// Start starts the HTTP server, which runs until Shutdown is called
+func (s *Server) Start() {
+	log.Printf("Admin API listening on %s", s.server.Addr)
+
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Admin API stopped: %v", err)
+	}
+}
+
+// Shutdown stops the HTTP server, waiting for the requests being handled
+// until the context is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// handleListPeers lists the known peers with their liveness information
+func (s *Server) handleListPeers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.networkManager.GetPeers())
+}
+
+// handleBroadcastStats returns the broadcast deduplication metrics
+func (s *Server) handleBroadcastStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.networkManager.GetBroadcastStats())
+}
+
+// handleBandwidthStats returns the traffic counters per peer and per command
+func (s *Server) handleBandwidthStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.networkManager.GetBandwidthStats())
+}
+
+// writeJSON writes a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write API response: %v", err)
+	}
+}
+
+// writeError writes a JSON error response with the given status code
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
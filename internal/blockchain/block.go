@@ -9,71 +9,111 @@ import (
 	"time"
 )
 
+// DefaultMaxNonce is the size of the nonce space searched by Mine
+const DefaultMaxNonce = 4294967296
+
+// mineCheckInterval is the number of hashes between two calls of the stop
+// function of MineRange
+const mineCheckInterval = 256
+
 // Block represents a single block in the blockchain
 type Block struct {
-	Index               int    `json:"index"`
-	Timestamp           int64  `json:"timestamp"`
-	Difficulty          int    `json:"difficulty"`
-	NextBlockDifficulty int    `json:"next_block_difficulty"`
-	Data                string `json:"data"`
-	Hash                string `json:"hash"`
-	PreviousHash        string `json:"previous_hash"`
-	Nonce               int    `json:"nonce"`
+	BlockHeader
+	Data string `json:"data"`
 }
 
 // NewBlock creates a new block with the given parameters
 func NewBlock(index int, difficulty, nextDifficulty int, data, previousHash string) *Block {
 	return &Block{
-		Index:               index,
-		Timestamp:           time.Now().Unix(),
-		Difficulty:          difficulty,
-		NextBlockDifficulty: nextDifficulty,
-		Data:                data,
-		PreviousHash:        previousHash,
-		Nonce:               0,
+		BlockHeader: BlockHeader{
+			Index:               index,
+			Timestamp:           time.Now().Unix(),
+			Difficulty:          difficulty,
+			NextBlockDifficulty: nextDifficulty,
+			DataHash:            ComputeDataHash(data),
+			PreviousHash:        previousHash,
+			Nonce:               0,
+		},
+		Data: data,
 	}
 }
 
-// ComputeHash computes the hash of the block
-func (b *Block) ComputeHash() string {
-	data := fmt.Sprintf("%d%d%s%d%d%d%s",
-		b.Index, b.Nonce, b.PreviousHash, b.Difficulty,
-		b.NextBlockDifficulty, b.Timestamp, b.Data)
-
+// ComputeDataHash computes the hash of the block data committed in the header
+func ComputeDataHash(data string) string {
 	hasher := sha512.New()
 	hasher.Write([]byte(data))
 	return base64.URLEncoding.EncodeToString(hasher.Sum(nil))
 }
 
-// IsHashValid checks if the block's hash meets the difficulty requirement
-func (b *Block) IsHashValid(hash string) bool {
-	if b.Difficulty == 0 {
-		return true
-	}
+// Mine performs proof-of-work mining on the block with the given function
+func (b *Block) Mine(pow PoW) {
+	b.MineRange(pow, 0, DefaultMaxNonce, 1, nil)
+}
 
-	prefix := strings.Repeat("0", b.Difficulty)
-	return strings.HasPrefix(hash, prefix)
+// MineRange searches the proof-of-work of the block by trying every nonce of
+// [start, end) in order. Once the range is exhausted, the extra nonce is
+// advanced by extraNonceStep and the timestamp refreshed before trying the
+// range again, so that no header is hashed twice. Miners sharing a template
+// use disjoint ranges or extra nonces congruent modulo the step.
+//
+// The search gives up when stop returns true, which is checked every few
+// hundred hashes. It returns whether a valid hash was found and the number of
+// hashes computed.
+func (b *Block) MineRange(pow PoW, start, end int, extraNonceStep uint64, stop func() bool) (bool, uint64) {
+	return b.MineShares(pow, start, end, extraNonceStep, 0, nil, stop)
 }
 
-// Mine performs proof-of-work mining on the block
-func (b *Block) Mine() {
-	for !b.IsHashValid(b.Hash) {
-		b.Timestamp = time.Now().Unix()
-		b.Nonce = int(time.Now().UnixNano() % 4294967296)
-		b.Hash = b.ComputeHash()
+// MineShares searches the proof-of-work of the block like MineRange, calling
+// share with a copy of the block for every hash that meets the lower share
+// difficulty but not the difficulty of the block
+func (b *Block) MineShares(pow PoW, start, end int, extraNonceStep uint64, shareDifficulty int, share func(*Block), stop func() bool) (bool, uint64) {
+	if end <= start {
+		end = start + 1
+	}
+	if extraNonceStep == 0 {
+		extraNonceStep = 1
+	}
+	sharePrefix := strings.Repeat("0", shareDifficulty)
+
+	var hashes uint64
+	b.Nonce = start
+	for {
+		if stop != nil && hashes%mineCheckInterval == 0 && stop() {
+			return false, hashes
+		}
+
+		b.Hash = b.ComputeHash(pow)
+		hashes++
+
+		if b.IsHashValid(b.Hash) {
+			return true, hashes
+		}
+
+		if share != nil && strings.HasPrefix(b.Hash, sharePrefix) {
+			shareBlock := *b
+			share(&shareBlock)
+		}
+
+		// Roll the extra nonce and the timestamp when the range is exhausted
+		b.Nonce++
+		if b.Nonce >= end {
+			b.Nonce = start
+			b.ExtraNonce += extraNonceStep
+			b.Timestamp = time.Now().Unix()
+		}
 	}
 }
 
 // IsValid validates the block integrity
-func (b *Block) IsValid() error {
-	// Check if calculated hash matches stored hash
-	if calculatedHash := b.ComputeHash(); calculatedHash != b.Hash {
-		return fmt.Errorf("block hash mismatch: calculated %s, stored %s", calculatedHash, b.Hash)
+func (b *Block) IsValid(pow PoW) error {
+	// Check the header hash and proof-of-work
+	if err := b.BlockHeader.IsValid(pow); err != nil {
+		return err
 	}
 
-	// Check if hash meets difficulty requirement
-	if !b.IsHashValid(b.Hash) {
-		return fmt.Errorf("block hash does not meet difficulty requirement")
+	// Check if the data matches the header commitment
+	if dataHash := ComputeDataHash(b.Data); dataHash != b.DataHash {
+		return fmt.Errorf("block data hash mismatch: calculated %s, stored %s", dataHash, b.DataHash)
 	}
 
 	// Check block size limit (2MB)
@@ -0,0 +1,134 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+)
+
+// benchmarkDifficulty is the difficulty of the blocks mined by the benchmarks,
+// solved in 4096 hashes on average
+const benchmarkDifficulty = 2
+
+// headerState is the part of a header that changes while mining
+type headerState struct {
+	nonce      int
+	extraNonce uint64
+	timestamp  int64
+}
+
+// recordingPoW records the state of a block at every hash and never produces
+// a valid hash
+type recordingPoW struct {
+	block  *Block
+	hashed []headerState
+}
+
+func (p *recordingPoW) Name() string {
+	return "recording"
+}
+
+func (p *recordingPoW) Hash(data []byte) string {
+	p.hashed = append(p.hashed, headerState{
+		nonce:      p.block.Nonce,
+		extraNonce: p.block.ExtraNonce,
+		timestamp:  p.block.Timestamp,
+	})
+	return "invalid"
+}
+
+func TestMineRangeRollsExtraNonceAndTimestamp(t *testing.T) {
+	const (
+		start, end = 0, 8
+		step       = 3
+		initial    = 1
+		hashes     = 1024
+	)
+
+	block := NewBlock(1, 1, 1, "data", "previous")
+	block.ExtraNonce = initial
+	block.Timestamp = 0
+
+	pow := &recordingPoW{block: block}
+	found, computed := block.MineRange(pow, start, end, step, func() bool {
+		return len(pow.hashed) >= hashes
+	})
+
+	if found {
+		t.Fatal("found a valid hash with a proof-of-work producing none")
+	}
+	if computed != uint64(len(pow.hashed)) || computed < hashes {
+		t.Fatalf("reported %d hashes, computed %d", computed, len(pow.hashed))
+	}
+
+	seen := make(map[headerState]bool, len(pow.hashed))
+	for i, state := range pow.hashed {
+		if state.nonce < start || state.nonce >= end {
+			t.Fatalf("hash %d used nonce %d outside [%d, %d)", i, state.nonce, start, end)
+		}
+
+		if state.extraNonce%step != initial%step {
+			t.Fatalf("hash %d used extra nonce %d, not congruent to %d modulo %d", i, state.extraNonce, initial, step)
+		}
+
+		// Each range pass uses the next extra nonce
+		if want := initial + uint64(i/(end-start))*step; state.extraNonce != want {
+			t.Fatalf("hash %d used extra nonce %d, want %d", i, state.extraNonce, want)
+		}
+
+		// The timestamp is refreshed once the first range pass is exhausted
+		if (state.timestamp == 0) != (i < end-start) {
+			t.Fatalf("hash %d used timestamp %d", i, state.timestamp)
+		}
+
+		pair := headerState{nonce: state.nonce, extraNonce: state.extraNonce}
+		if seen[pair] {
+			t.Fatalf("hash %d repeated nonce %d with extra nonce %d", i, state.nonce, state.extraNonce)
+		}
+		seen[pair] = true
+	}
+}
+
+func TestMineRangeStops(t *testing.T) {
+	block := NewBlock(1, 64, 64, "data", "previous")
+
+	stops := 0
+	found, hashes := block.MineRange(DefaultPoW, 0, DefaultMaxNonce, 1, func() bool {
+		stops++
+		return stops > 2
+	})
+
+	if found {
+		t.Fatal("found a hash at difficulty 64")
+	}
+	if hashes != 2*mineCheckInterval {
+		t.Fatalf("computed %d hashes, want %d before the third check", hashes, 2*mineCheckInterval)
+	}
+}
+
+// BenchmarkMineSequential mines blocks trying nonces in order
+func BenchmarkMineSequential(b *testing.B) {
+	var hashes uint64
+	for i := 0; i < b.N; i++ {
+		block := NewBlock(i+1, benchmarkDifficulty, benchmarkDifficulty, "benchmark", "previous")
+		_, computed := block.MineRange(DefaultPoW, 0, DefaultMaxNonce, 1, nil)
+		hashes += computed
+	}
+	b.ReportMetric(float64(hashes)/float64(b.N), "hashes/op")
+}
+
+// BenchmarkMineTimeNonce mines blocks deriving the nonce from the current
+// time, as blocks were mined before nonces were tried in order. Nonces drawn
+// in the same clock tick are hashed again.
+func BenchmarkMineTimeNonce(b *testing.B) {
+	var hashes uint64
+	for i := 0; i < b.N; i++ {
+		block := NewBlock(i+1, benchmarkDifficulty, benchmarkDifficulty, "benchmark", "previous")
+		for block.Hash = block.ComputeHash(DefaultPoW); !block.IsHashValid(block.Hash); block.Hash = block.ComputeHash(DefaultPoW) {
+			block.Timestamp = time.Now().Unix()
+			block.Nonce = int(time.Now().UnixNano() % 4294967296)
+			hashes++
+		}
+		hashes++
+	}
+	b.ReportMetric(float64(hashes)/float64(b.N), "hashes/op")
+}
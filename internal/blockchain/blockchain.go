@@ -3,15 +3,28 @@ package blockchain
 import (
 	"fmt"
 	"log"
+	"math/big"
 	"sync"
 )
 
+// RegtestDifficulty is the fixed difficulty of regtest chains, solved in 64
+// hashes on average so that tests can produce blocks instantly
+const RegtestDifficulty = 1
+
 // Blockchain represents the main blockchain structure
 type Blockchain struct {
 	mu                          sync.RWMutex
 	difficultyCalculationBlocks int
 	targetBlockTime             int
+	genesisHash                 string
+	pow                         PoW
+	fixedDifficulty             int
+	membership                  *Membership
+	membershipCheckpoints       []membershipCheckpoint
+	pendingUpdates              []MembershipUpdate
 	chain                       []*Block
+	tipSubscribers              map[int]chan *Block
+	nextSubscriberID            int
 }
 
 // New creates a new blockchain instance
@@ -19,7 +32,9 @@ func New(difficultyCalculationBlocks, targetBlockTime int) *Blockchain {
 	return &Blockchain{
 		difficultyCalculationBlocks: difficultyCalculationBlocks,
 		targetBlockTime:             targetBlockTime,
+		pow:                         DefaultPoW,
 		chain:                       make([]*Block, 0),
+		tipSubscribers:              make(map[int]chan *Block),
 	}
 }
 
@@ -27,8 +42,13 @@ func New(difficultyCalculationBlocks, targetBlockTime int) *Blockchain {
 func (bc *Blockchain) CreateGenesisBlock() *Block {
 	log.Println("Mining genesis block...")
 
-	genesis := NewBlock(0, 2, 2, "Genesis Block", "")
-	genesis.Mine()
+	difficulty := 2
+	if fixed := bc.GetFixedDifficulty(); fixed > 0 {
+		difficulty = fixed
+	}
+
+	genesis := NewBlock(0, difficulty, difficulty, "Genesis Block", "")
+	genesis.Mine(bc.GetPoW())
 	
 	bc.AddBlockWithoutVerification(genesis)
 
@@ -36,35 +56,287 @@ func (bc *Blockchain) CreateGenesisBlock() *Block {
 	return genesis
 }
 
+// SetGenesisHash sets the expected genesis block hash, checked when a genesis
+// block is received from the network. An empty hash accepts any valid genesis.
+func (bc *Blockchain) SetGenesisHash(hash string) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.genesisHash = hash
+}
+
+// SetPoW sets the proof-of-work function of the chain, used to validate
+// blocks and to mine new ones
+func (bc *Blockchain) SetPoW(pow PoW) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.pow = pow
+}
+
+// GetPoW returns the proof-of-work function of the chain
+func (bc *Blockchain) GetPoW() PoW {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.pow
+}
+
+// SetFixedDifficulty gives every block, including the genesis block, the
+// given difficulty instead of adjusting it to the target block time. A
+// difficulty of 0 restores the adjustment.
+func (bc *Blockchain) SetFixedDifficulty(difficulty int) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.fixedDifficulty = difficulty
+}
+
+// GetFixedDifficulty returns the fixed difficulty of the chain, 0 if it is adjusted
+func (bc *Blockchain) GetFixedDifficulty() int {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.fixedDifficulty
+}
+
+// GetDifficultyRules returns the difficulty adjustment rules of the chain
+func (bc *Blockchain) GetDifficultyRules() DifficultyRules {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.difficultyRules()
+}
+
+// difficultyRules returns the difficulty adjustment rules (internal use, no locking)
+func (bc *Blockchain) difficultyRules() DifficultyRules {
+	return DifficultyRules{
+		AdjustmentBlocks: bc.difficultyCalculationBlocks,
+		TargetBlockTime:  bc.targetBlockTime,
+		FixedDifficulty:  bc.fixedDifficulty,
+	}
+}
+
+// chainHeaderAt returns an accessor to the headers of the given blocks,
+// starting at the genesis block
+func chainHeaderAt(blocks []*Block) HeaderAt {
+	return func(index int) *BlockHeader {
+		return &blocks[index].BlockHeader
+	}
+}
+
+// SetMembership makes the chain permissioned: only producers of the given
+// genesis membership, as updated by the membership updates recorded on chain,
+// may produce blocks. A nil membership keeps the chain permissionless.
+func (bc *Blockchain) SetMembership(membership *Membership) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	bc.membership = membership
+	bc.membershipCheckpoints = nil
+	for _, block := range bc.chain {
+		bc.recordMembership(block)
+	}
+}
+
+// IsPermissioned checks if block production is restricted to known producers
+func (bc *Blockchain) IsPermissioned() bool {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.membership != nil
+}
+
+// GetMembership returns the membership at the tip of the chain, or nil on a
+// permissionless chain
+func (bc *Blockchain) GetMembership() *Membership {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if bc.membership == nil {
+		return nil
+	}
+	return bc.membershipAt(len(bc.chain) - 1).Clone()
+}
+
+// membershipCheckpoint is the membership after a block carrying membership updates
+type membershipCheckpoint struct {
+	index      int
+	membership *Membership
+}
+
+// membershipAt returns the membership after the block at the given index, to
+// be cloned before any change (internal use, no locking)
+func (bc *Blockchain) membershipAt(index int) *Membership {
+	// Updates are rare and mostly read at the tip
+	for i := len(bc.membershipCheckpoints) - 1; i >= 0; i-- {
+		if bc.membershipCheckpoints[i].index <= index {
+			return bc.membershipCheckpoints[i].membership
+		}
+	}
+	return bc.membership
+}
+
+// recordMembership records the membership after a block appended to the
+// chain, if the block carries updates (internal use, requires the write lock)
+func (bc *Blockchain) recordMembership(block *Block) {
+	if bc.membership == nil {
+		return
+	}
+
+	if updates, err := ParseMembershipData(block.Data); err == nil && len(updates) == 0 {
+		return
+	}
+
+	// Blocks of the chain were validated, including their updates
+	membership := bc.membershipAt(block.Index - 1).Clone()
+	membership.ApplyBlock(block)
+	bc.membershipCheckpoints = append(bc.membershipCheckpoints, membershipCheckpoint{
+		index:      block.Index,
+		membership: membership,
+	})
+}
+
+// truncateMemberships drops the memberships recorded after the block at the
+// given index (internal use, requires the write lock)
+func (bc *Blockchain) truncateMemberships(index int) {
+	kept := len(bc.membershipCheckpoints)
+	for kept > 0 && bc.membershipCheckpoints[kept-1].index > index {
+		kept--
+	}
+	bc.membershipCheckpoints = bc.membershipCheckpoints[:kept]
+}
+
+// validatePermissions checks that a block is signed by a producer of the
+// membership and carries valid membership updates
+func validatePermissions(membership *Membership, block *Block) error {
+	if !membership.IsProducer(block.Producer) {
+		return fmt.Errorf("block producer %q is not allowed to produce blocks", block.Producer)
+	}
+
+	if err := block.VerifySignature(); err != nil {
+		return err
+	}
+
+	return membership.Clone().ApplyBlock(block)
+}
+
+// ProposeMembershipUpdate queues a membership update to be recorded in the
+// next block produced by this node
+func (bc *Blockchain) ProposeMembershipUpdate(update MembershipUpdate) error {
+	if err := update.Validate(); err != nil {
+		return err
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if bc.membership == nil {
+		return fmt.Errorf("blockchain is not permissioned")
+	}
+
+	bc.pendingUpdates = append(bc.pendingUpdates, update)
+	return nil
+}
+
+// PendingMembershipUpdates returns the queued membership updates that are not
+// recorded on chain yet and can be applied to the current membership
+func (bc *Blockchain) PendingMembershipUpdates() []MembershipUpdate {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	return bc.pendingMembershipUpdates()
+}
+
+// pendingMembershipUpdates drops the queued membership updates that were
+// recorded or no longer apply and returns the others (internal use, requires
+// the write lock)
+func (bc *Blockchain) pendingMembershipUpdates() []MembershipUpdate {
+	if bc.membership == nil {
+		return nil
+	}
+
+	membership := bc.membershipAt(len(bc.chain) - 1).Clone()
+	pending := make([]MembershipUpdate, 0, len(bc.pendingUpdates))
+	for _, update := range bc.pendingUpdates {
+		if membership.IsApplied(update) {
+			continue
+		}
+
+		if err := membership.Apply(update); err != nil {
+			log.Printf("Dropping membership update: %v", err)
+			continue
+		}
+		pending = append(pending, update)
+	}
+
+	bc.pendingUpdates = pending
+	return pending
+}
+
+// AddGenesisBlock adds a genesis block received from the network to an empty chain
+func (bc *Blockchain) AddGenesisBlock(block *Block) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if len(bc.chain) != 0 {
+		return fmt.Errorf("blockchain already has a genesis block")
+	}
+
+	if block.Index != 0 || block.PreviousHash != "" {
+		return fmt.Errorf("block #%d is not a genesis block", block.Index)
+	}
+
+	if bc.genesisHash != "" && block.Hash != bc.genesisHash {
+		return fmt.Errorf("genesis hash %s does not match expected %s", block.Hash, bc.genesisHash)
+	}
+
+	if err := validateGenesisDifficulty(&block.BlockHeader); err != nil {
+		return err
+	}
+
+	if err := block.IsValid(bc.pow); err != nil {
+		return fmt.Errorf("genesis block validation failed: %w", err)
+	}
+
+	bc.chain = append(bc.chain, block)
+	bc.recordMembership(block)
+	bc.notifyTip(block)
+	return nil
+}
+
 // CanAddBlock checks if a block can be added to the chain
 func (bc *Blockchain) CanAddBlock(block *Block) error {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
 
+	return bc.canAddBlock(block)
+}
+
+// canAddBlock checks if a block can be added to the chain (internal use, no locking)
+func (bc *Blockchain) canAddBlock(block *Block) error {
 	if len(bc.chain) == 0 {
 		return fmt.Errorf("blockchain is empty")
 	}
 
-	latestBlock := bc.chain[len(bc.chain)-1]
+	if err := bc.validateNextBlock(bc.chain[len(bc.chain)-1], block, chainHeaderAt(bc.chain)); err != nil {
+		return err
+	}
 
-	// Check difficulty
-	if block.Difficulty != latestBlock.NextBlockDifficulty {
-		return fmt.Errorf("block difficulty %d does not match expected %d",
-			block.Difficulty, latestBlock.NextBlockDifficulty)
+	if bc.membership != nil {
+		return validatePermissions(bc.membershipAt(len(bc.chain)-1), block)
 	}
 
-	// Check index
-	if block.Index != latestBlock.Index+1 {
-		return fmt.Errorf("block index %d is not sequential", block.Index)
+	return nil
+}
+
+// validateNextBlock checks if a block can follow the given previous block,
+// reading the headers of its chain through headerAt (internal use, no locking)
+func (bc *Blockchain) validateNextBlock(previousBlock, block *Block, headerAt HeaderAt) error {
+	// Check header linkage and proof-of-work
+	if err := ValidateNextHeader(bc.pow, &previousBlock.BlockHeader, &block.BlockHeader); err != nil {
+		return err
 	}
 
-	// Check previous hash
-	if block.PreviousHash != latestBlock.Hash {
-		return fmt.Errorf("block previous hash does not match latest block hash")
+	if err := bc.difficultyRules().ValidateNextDifficulty(&previousBlock.BlockHeader, &block.BlockHeader, headerAt); err != nil {
+		return err
 	}
 
 	// Validate block
-	if err := block.IsValid(); err != nil {
+	if err := block.IsValid(bc.pow); err != nil {
 		return fmt.Errorf("block validation failed: %w", err)
 	}
 
@@ -73,11 +345,15 @@ func (bc *Blockchain) CanAddBlock(block *Block) error {
 
 // AddBlock adds a block to the chain with verification
 func (bc *Blockchain) AddBlock(block *Block) error {
-	if err := bc.CanAddBlock(block); err != nil {
+	// Validate and append under the same lock, so that no other block
+	// extends the tip in between
+	bc.mu.Lock()
+	if err := bc.canAddBlock(block); err != nil {
+		bc.mu.Unlock()
 		return fmt.Errorf("cannot add block: %w", err)
 	}
-
-	bc.AddBlockWithoutVerification(block)
+	bc.appendBlock(block)
+	bc.mu.Unlock()
 
 	log.Printf("Added block #%d to chain - Hash: %s, Difficulty: %d, Nonce: %d", 
 		block.Index, block.Hash, block.Difficulty, block.Nonce)
@@ -87,10 +363,17 @@ func (bc *Blockchain) AddBlock(block *Block) error {
 // AddBlockWithoutVerification adds a block without validation (for syncing)
 func (bc *Blockchain) AddBlockWithoutVerification(block *Block) {
 	bc.mu.Lock()
-	bc.chain = append(bc.chain, block)
+	bc.appendBlock(block)
 	bc.mu.Unlock()
 }
 
+// appendBlock appends a block to the chain (internal use, no locking)
+func (bc *Blockchain) appendBlock(block *Block) {
+	bc.chain = append(bc.chain, block)
+	bc.recordMembership(block)
+	bc.notifyTip(block)
+}
+
 // HasBlock checks if a block with the given index exists
 func (bc *Blockchain) HasBlock(index int) bool {
 	bc.mu.RLock()
@@ -111,6 +394,27 @@ func (bc *Blockchain) GetBlock(index int) (*Block, error) {
 	return bc.chain[index], nil
 }
 
+// GetBlockByHash returns the block of the main chain with the given hash
+func (bc *Blockchain) GetBlockByHash(hash string) (*Block, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	// Recent blocks are the most requested, search from the tip
+	for i := len(bc.chain) - 1; i >= 0; i-- {
+		if bc.chain[i].Hash == hash {
+			return bc.chain[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("block %s not found", hash)
+}
+
+// HasBlockHash checks if a block with the given hash is part of the main chain
+func (bc *Blockchain) HasBlockHash(hash string) bool {
+	_, err := bc.GetBlockByHash(hash)
+	return err == nil
+}
+
 // GetLatestBlock returns the most recent block
 func (bc *Blockchain) GetLatestBlock() (*Block, error) {
 	bc.mu.RLock()
@@ -139,12 +443,17 @@ func (bc *Blockchain) IsValid() error {
 		return fmt.Errorf("blockchain is empty")
 	}
 
+	var membership *Membership
+	if bc.membership != nil {
+		membership = bc.membership.Clone()
+	}
+
 	for i := 1; i < len(bc.chain); i++ {
 		currentBlock := bc.chain[i]
 		previousBlock := bc.chain[i-1]
 
 		// Validate individual block
-		if err := currentBlock.IsValid(); err != nil {
+		if err := currentBlock.IsValid(bc.pow); err != nil {
 			return fmt.Errorf("block #%d is invalid: %w", currentBlock.Index, err)
 		}
 
@@ -152,6 +461,14 @@ func (bc *Blockchain) IsValid() error {
 		if currentBlock.PreviousHash != previousBlock.Hash {
 			return fmt.Errorf("chain integrity broken at block #%d", currentBlock.Index)
 		}
+
+		// Check the producer on permissioned chains
+		if membership != nil {
+			if err := validatePermissions(membership, currentBlock); err != nil {
+				return fmt.Errorf("block #%d is not permitted: %w", currentBlock.Index, err)
+			}
+			membership.ApplyBlock(currentBlock)
+		}
 	}
 
 	return nil
@@ -178,49 +495,109 @@ func (bc *Blockchain) CalculateAverageMiningTime(startBlock, stopBlock int) (int
 	return int(totalTime / int64(blockCount)), nil
 }
 
+// EstimateNetworkHashRate estimates the hashes per second of the whole network
+// from the work of the last given number of blocks and the time they took
+func (bc *Blockchain) EstimateNetworkHashRate(blocks int) (float64, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if blocks < 1 || len(bc.chain) < 2 {
+		return 0, fmt.Errorf("not enough blocks to estimate the network hash rate")
+	}
+
+	start := len(bc.chain) - 1 - blocks
+	if start < 0 {
+		start = 0
+	}
+
+	// The first block only marks the start of the interval
+	work := blocksWork(bc.chain[start+1:])
+
+	elapsed := bc.chain[len(bc.chain)-1].Timestamp - bc.chain[start].Timestamp
+	if elapsed <= 0 {
+		return 0, fmt.Errorf("blocks %d to %d have no elapsed time", start, len(bc.chain)-1)
+	}
+
+	hashes, _ := new(big.Float).SetInt(work).Float64()
+	return hashes / float64(elapsed), nil
+}
+
 // ShouldRecalculateDifficulty checks if difficulty should be recalculated
 func (bc *Blockchain) ShouldRecalculateDifficulty() bool {
-	latestBlock, err := bc.GetLatestBlock()
-	if err != nil {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if len(bc.chain) == 0 {
 		return false
 	}
 
-	return latestBlock.Index > 0 &&
-		latestBlock.Index%bc.difficultyCalculationBlocks == 0
+	return bc.difficultyRules().adjusts(&bc.chain[len(bc.chain)-1].BlockHeader)
 }
 
-// CalculateNewDifficulty calculates the new difficulty based on recent mining times
-func (bc *Blockchain) CalculateNewDifficulty() (int, error) {
-	latestBlock, err := bc.GetLatestBlock()
-	if err != nil {
-		return 0, fmt.Errorf("failed to get latest block: %w", err)
-	}
+// TipSnapshot is the state of the chain the next block is built on, read at
+// once so that a new tip cannot arrive in between
+type TipSnapshot struct {
+	// Tip is the latest block of the chain
+	Tip *Block
+
+	// NextBlockDifficulty is the next block difficulty committed by the block
+	// following the tip
+	NextBlockDifficulty int
+
+	// Membership is the membership at the tip, nil on permissionless chains
+	Membership *Membership
+
+	// PendingUpdates are the queued membership updates applicable to Membership
+	PendingUpdates []MembershipUpdate
+}
 
-	startIndex := latestBlock.Index - bc.difficultyCalculationBlocks
-	if startIndex < 0 {
-		startIndex = 0
+// GetTipSnapshot returns the state of the chain the next block is built on
+func (bc *Blockchain) GetTipSnapshot() (*TipSnapshot, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if len(bc.chain) == 0 {
+		return nil, fmt.Errorf("blockchain is empty")
 	}
 
-	averageTime, err := bc.CalculateAverageMiningTime(startIndex, latestBlock.Index)
-	if err != nil {
-		return 0, fmt.Errorf("failed to calculate average mining time: %w", err)
+	tip := bc.chain[len(bc.chain)-1]
+	snapshot := &TipSnapshot{
+		Tip:                 tip,
+		NextBlockDifficulty: bc.difficultyRules().NextDifficulty(&tip.BlockHeader, chainHeaderAt(bc.chain)),
+		PendingUpdates:      bc.pendingMembershipUpdates(),
+	}
+	if bc.membership != nil {
+		snapshot.Membership = bc.membershipAt(len(bc.chain) - 1).Clone()
 	}
+	return snapshot, nil
+}
 
-	currentDifficulty := latestBlock.Difficulty
-	targetTime := bc.targetBlockTime
+// CalculateNewDifficulty calculates the next block difficulty of the block
+// following the latest block, based on recent mining times
+func (bc *Blockchain) CalculateNewDifficulty() (int, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
 
-	// Adjust difficulty based on average mining time
-	if averageTime > int(float64(targetTime)*1.25) {
-		// Mining is too slow, decrease difficulty
-		if currentDifficulty > 0 {
-			currentDifficulty--
-		}
-	} else if averageTime < int(float64(targetTime)*0.75) {
-		// Mining is too fast, increase difficulty
-		currentDifficulty++
+	if len(bc.chain) == 0 {
+		return 0, fmt.Errorf("failed to get latest block: blockchain is empty")
 	}
 
-	return currentDifficulty, nil
+	latestBlock := bc.chain[len(bc.chain)-1]
+	return bc.difficultyRules().NextDifficulty(&latestBlock.BlockHeader, chainHeaderAt(bc.chain)), nil
+}
+
+// WorkAfter returns the work of the blocks of the main chain after the given index
+func (bc *Blockchain) WorkAfter(index int) *big.Int {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if index < -1 {
+		index = -1
+	}
+	if index >= len(bc.chain) {
+		return new(big.Int)
+	}
+	return blocksWork(bc.chain[index+1:])
 }
 
 // GetBlocks returns a slice of blocks in the specified range
@@ -237,6 +614,28 @@ func (bc *Blockchain) GetBlocks(startIndex, endIndex int) ([]*Block, error) {
 	return blocks, nil
 }
 
+// GetHeaders returns up to count headers starting at startIndex
+func (bc *Blockchain) GetHeaders(startIndex, count int) ([]*BlockHeader, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if startIndex < 0 || startIndex > len(bc.chain) || count < 0 {
+		return nil, fmt.Errorf("invalid header range: %d (+%d)", startIndex, count)
+	}
+
+	endIndex := startIndex + count
+	if endIndex > len(bc.chain) {
+		endIndex = len(bc.chain)
+	}
+
+	headers := make([]*BlockHeader, 0, endIndex-startIndex)
+	for _, block := range bc.chain[startIndex:endIndex] {
+		header := block.BlockHeader
+		headers = append(headers, &header)
+	}
+	return headers, nil
+}
+
 // String returns a string representation of the blockchain
 func (bc *Blockchain) String() string {
 	bc.mu.RLock()
@@ -245,11 +644,116 @@ func (bc *Blockchain) String() string {
 	return fmt.Sprintf("Blockchain with %d blocks", len(bc.chain))
 }
 
-// ReplaceChain replaces the local blockchain with a new chain (used for syncing from a peer)
-func (bc *Blockchain) ReplaceChain(newChain []*Block) {
+// Reset removes every block from the chain (used when a sync from a peer fails)
+func (bc *Blockchain) Reset() {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
-	
-	bc.chain = make([]*Block, len(newChain))
-	copy(bc.chain, newChain)
+
+	bc.chain = make([]*Block, 0)
+	bc.membershipCheckpoints = nil
+}
+
+// Reorganize switches the main chain to a branch of consecutive blocks forking
+// off the main chain, as long as the branch is valid and carries more work than
+// the blocks it replaces
+func (bc *Blockchain) Reorganize(branch []*Block) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if len(branch) == 0 {
+		return fmt.Errorf("branch is empty")
+	}
+
+	forkIndex := branch[0].Index - 1
+	if forkIndex < 0 || forkIndex >= len(bc.chain) {
+		return fmt.Errorf("branch does not fork off the main chain")
+	}
+
+	// A longer branch of easier blocks must not replace a heavier chain
+	if blocksWork(branch).Cmp(blocksWork(bc.chain[forkIndex+1:])) <= 0 {
+		return fmt.Errorf("branch ending at #%d does not carry more work than the main chain", branch[len(branch)-1].Index)
+	}
+
+	var membership *Membership
+	if bc.membership != nil {
+		membership = bc.membershipAt(forkIndex).Clone()
+	}
+
+	// Headers up to the fork come from the main chain, the others from the branch
+	headerAt := func(index int) *BlockHeader {
+		if index <= forkIndex {
+			return &bc.chain[index].BlockHeader
+		}
+		return &branch[index-forkIndex-1].BlockHeader
+	}
+
+	previousBlock := bc.chain[forkIndex]
+	for _, block := range branch {
+		if err := bc.validateNextBlock(previousBlock, block, headerAt); err != nil {
+			return fmt.Errorf("branch block #%d is invalid: %w", block.Index, err)
+		}
+
+		if membership != nil {
+			if err := validatePermissions(membership, block); err != nil {
+				return fmt.Errorf("branch block #%d is not permitted: %w", block.Index, err)
+			}
+			membership.ApplyBlock(block)
+		}
+		previousBlock = block
+	}
+
+	chain := make([]*Block, forkIndex+1, forkIndex+1+len(branch))
+	copy(chain, bc.chain[:forkIndex+1])
+	bc.chain = append(chain, branch...)
+
+	// Only the memberships of the replaced blocks are recomputed
+	bc.truncateMemberships(forkIndex)
+	for _, block := range branch {
+		bc.recordMembership(block)
+	}
+	bc.notifyTip(previousBlock)
+
+	log.Printf("Reorganized chain at block #%d, new tip #%d", forkIndex, previousBlock.Index)
+	return nil
+}
+
+// blocksWork returns the total work of the given blocks
+func blocksWork(blocks []*Block) *big.Int {
+	work := new(big.Int)
+	for _, block := range blocks {
+		work.Add(work, block.Work())
+	}
+	return work
+}
+
+// SubscribeTip returns a channel receiving the new tip whenever the main chain
+// changes, along with a function to cancel the subscription. Only the latest
+// tip is kept for slow subscribers.
+func (bc *Blockchain) SubscribeTip() (<-chan *Block, func()) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	id := bc.nextSubscriberID
+	bc.nextSubscriberID++
+
+	tips := make(chan *Block, 1)
+	bc.tipSubscribers[id] = tips
+
+	return tips, func() {
+		bc.mu.Lock()
+		defer bc.mu.Unlock()
+		delete(bc.tipSubscribers, id)
+	}
+}
+
+// notifyTip sends the new tip to every subscriber, replacing the tip they
+// have not received yet (internal use, requires the write lock)
+func (bc *Blockchain) notifyTip(tip *Block) {
+	for _, tips := range bc.tipSubscribers {
+		select {
+		case <-tips:
+		default:
+		}
+		tips <- tip
+	}
 }
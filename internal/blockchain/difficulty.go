@@ -0,0 +1,77 @@
+package blockchain
+
+import "fmt"
+
+// DifficultyRules are the consensus rules adjusting the difficulty of a chain
+// to its target block time. Every AdjustmentBlocks blocks, the next block
+// difficulty moves one step towards the target block time; in between, and on
+// chains with a fixed difficulty, it is carried over from the previous block.
+type DifficultyRules struct {
+	AdjustmentBlocks int
+	TargetBlockTime  int
+	FixedDifficulty  int
+}
+
+// HeaderAt returns the header at the given index of the chain being validated
+type HeaderAt func(index int) *BlockHeader
+
+// adjusts checks if the next block difficulty is recalculated for the block
+// following latest
+func (r DifficultyRules) adjusts(latest *BlockHeader) bool {
+	return r.FixedDifficulty == 0 && r.AdjustmentBlocks > 0 &&
+		latest.Index > 0 && latest.Index%r.AdjustmentBlocks == 0
+}
+
+// NextDifficulty returns the next block difficulty of the block following
+// latest. The headers of the chain up to latest are read through headerAt.
+func (r DifficultyRules) NextDifficulty(latest *BlockHeader, headerAt HeaderAt) int {
+	if !r.adjusts(latest) {
+		return latest.NextBlockDifficulty
+	}
+
+	startIndex := latest.Index - r.AdjustmentBlocks
+	if startIndex < 0 {
+		startIndex = 0
+	}
+
+	averageTime := int((latest.Timestamp - headerAt(startIndex).Timestamp) / int64(latest.Index-startIndex))
+	difficulty := latest.Difficulty
+
+	// Adjust difficulty based on average mining time
+	if averageTime > int(float64(r.TargetBlockTime)*1.25) {
+		// Mining is too slow, decrease difficulty without making every hash valid
+		if difficulty > 1 {
+			difficulty--
+		}
+	} else if averageTime < int(float64(r.TargetBlockTime)*0.75) {
+		// Mining is too fast, increase difficulty
+		difficulty++
+	}
+
+	return difficulty
+}
+
+// ValidateNextDifficulty checks the next block difficulty committed by a
+// header following previous
+func (r DifficultyRules) ValidateNextDifficulty(previous, header *BlockHeader, headerAt HeaderAt) error {
+	if header.NextBlockDifficulty < 1 {
+		return fmt.Errorf("next block difficulty %d is below 1", header.NextBlockDifficulty)
+	}
+
+	if expected := r.NextDifficulty(previous, headerAt); header.NextBlockDifficulty != expected {
+		return fmt.Errorf("next block difficulty %d does not match expected %d",
+			header.NextBlockDifficulty, expected)
+	}
+
+	return nil
+}
+
+// validateGenesisDifficulty checks that a genesis header requires work from
+// itself and from its successor
+func validateGenesisDifficulty(header *BlockHeader) error {
+	if header.Difficulty < 1 || header.NextBlockDifficulty < 1 {
+		return fmt.Errorf("genesis difficulties %d and %d must be at least 1",
+			header.Difficulty, header.NextBlockDifficulty)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// BlockHeader holds the fields of a block covered by its proof-of-work
+type BlockHeader struct {
+	Index               int    `json:"index"`
+	Timestamp           int64  `json:"timestamp"`
+	Difficulty          int    `json:"difficulty"`
+	NextBlockDifficulty int    `json:"next_block_difficulty"`
+	DataHash            string `json:"data_hash"`
+	Hash                string `json:"hash"`
+	PreviousHash        string `json:"previous_hash"`
+	Nonce               int    `json:"nonce"`
+
+	// ExtraNonce extends the search space of the nonce, giving each mining
+	// worker its own headers to hash
+	ExtraNonce uint64 `json:"extra_nonce,omitempty"`
+
+	// Producer is the public key of the node that produced the block and
+	// Signature its signature of the hash, both only set on permissioned networks
+	Producer  string `json:"producer,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// ComputeHash computes the hash of the header with the given proof-of-work
+// function. The block data is committed through DataHash instead of in full;
+// this changed the hash of every block, so chains created before block headers
+// were introduced are not valid under these rules and must be started again
+// from a new genesis block.
+func (h *BlockHeader) ComputeHash(pow PoW) string {
+	data := fmt.Sprintf("%d%d%s%d%d%d%s",
+		h.Index, h.Nonce, h.PreviousHash, h.Difficulty,
+		h.NextBlockDifficulty, h.Timestamp, h.DataHash)
+
+	// Headers without an extra nonce keep their original hash
+	if h.ExtraNonce != 0 {
+		data += fmt.Sprintf(":%d", h.ExtraNonce)
+	}
+
+	// The producer is committed by the proof-of-work; unsigned headers keep their original hash
+	if h.Producer != "" {
+		data += h.Producer
+	}
+
+	return pow.Hash([]byte(data))
+}
+
+// IsHashValid checks if the hash meets the header's difficulty requirement
+func (h *BlockHeader) IsHashValid(hash string) bool {
+	if h.Difficulty == 0 {
+		return true
+	}
+
+	prefix := strings.Repeat("0", h.Difficulty)
+	return strings.HasPrefix(hash, prefix)
+}
+
+// IsValid validates the header hash and proof-of-work
+func (h *BlockHeader) IsValid(pow PoW) error {
+	// Check if calculated hash matches stored hash
+	if calculatedHash := h.ComputeHash(pow); calculatedHash != h.Hash {
+		return fmt.Errorf("block hash mismatch: calculated %s, stored %s", calculatedHash, h.Hash)
+	}
+
+	// Check if hash meets difficulty requirement
+	if !h.IsHashValid(h.Hash) {
+		return fmt.Errorf("block hash does not meet difficulty requirement")
+	}
+
+	return nil
+}
+
+// Sign signs the header hash with the producer private key
+func (h *BlockHeader) Sign(privateKey ed25519.PrivateKey) {
+	h.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, []byte(h.Hash)))
+}
+
+// VerifySignature checks that the header hash is signed by its producer
+func (h *BlockHeader) VerifySignature() error {
+	if h.Producer == "" {
+		return fmt.Errorf("block has no producer")
+	}
+
+	publicKey, err := DecodePublicKey(h.Producer)
+	if err != nil {
+		return fmt.Errorf("invalid block producer: %w", err)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(h.Signature)
+	if err != nil || !ed25519.Verify(publicKey, []byte(h.Hash), signature) {
+		return fmt.Errorf("invalid block signature")
+	}
+
+	return nil
+}
+
+// Work returns the expected number of hashes needed to mine the header.
+// Each leading zero of the base64 hash divides the odds by 64.
+func (h *BlockHeader) Work() *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(6*h.Difficulty))
+}
+
+// ValidateNextHeader checks if a header can follow the given previous header
+func ValidateNextHeader(pow PoW, previous, header *BlockHeader) error {
+	// Check difficulty
+	if header.Difficulty != previous.NextBlockDifficulty {
+		return fmt.Errorf("block difficulty %d does not match expected %d",
+			header.Difficulty, previous.NextBlockDifficulty)
+	}
+
+	// Check index
+	if header.Index != previous.Index+1 {
+		return fmt.Errorf("block index %d is not sequential", header.Index)
+	}
+
+	// Check previous hash
+	if header.PreviousHash != previous.Hash {
+		return fmt.Errorf("block previous hash does not match latest block hash")
+	}
+
+	return header.IsValid(pow)
+}
+
+// ValidateHeaderChain validates the linkage, proof-of-work and difficulty
+// adjustments of consecutive headers starting from the genesis header
+func ValidateHeaderChain(pow PoW, rules DifficultyRules, headers []*BlockHeader) error {
+	if len(headers) == 0 {
+		return fmt.Errorf("header chain is empty")
+	}
+
+	genesis := headers[0]
+	if genesis.Index != 0 || genesis.PreviousHash != "" {
+		return fmt.Errorf("header chain does not start with a genesis header")
+	}
+
+	if err := validateGenesisDifficulty(genesis); err != nil {
+		return err
+	}
+
+	if err := genesis.IsValid(pow); err != nil {
+		return fmt.Errorf("genesis header is invalid: %w", err)
+	}
+
+	for i := 1; i < len(headers); i++ {
+		if err := ValidateNextHeader(pow, headers[i-1], headers[i]); err != nil {
+			return fmt.Errorf("header #%d is invalid: %w", headers[i].Index, err)
+		}
+
+		if err := rules.ValidateNextDifficulty(headers[i-1], headers[i], headerSliceAt(headers)); err != nil {
+			return fmt.Errorf("header #%d is invalid: %w", headers[i].Index, err)
+		}
+	}
+
+	return nil
+}
+
+// headerSliceAt returns an accessor to headers starting at the genesis header
+func headerSliceAt(headers []*BlockHeader) HeaderAt {
+	return func(index int) *BlockHeader {
+		return headers[index]
+	}
+}
+
+// ChainWork returns the total work of a header chain
+func ChainWork(headers []*BlockHeader) *big.Int {
+	work := new(big.Int)
+	for _, header := range headers {
+		work.Add(work, header.Work())
+	}
+	return work
+}
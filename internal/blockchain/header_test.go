@@ -0,0 +1,152 @@
+package blockchain
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// fixedRules are the rules of a chain with a fixed difficulty of 1
+var fixedRules = DifficultyRules{AdjustmentBlocks: 10, TargetBlockTime: 10, FixedDifficulty: 1}
+
+// mineHeader mines a header again after it was modified
+func mineHeader(header *BlockHeader) {
+	block := &Block{BlockHeader: *header}
+	block.Nonce = 0
+	block.Mine(DefaultPoW)
+	*header = block.BlockHeader
+}
+
+// unsolveHeader gives a header a hash matching its content but not its difficulty
+func unsolveHeader(header *BlockHeader) {
+	for header.Hash = header.ComputeHash(DefaultPoW); header.IsHashValid(header.Hash); header.Hash = header.ComputeHash(DefaultPoW) {
+		header.Nonce++
+	}
+}
+
+// mineHeaderChain mines a chain of count headers of difficulty 1
+func mineHeaderChain(count int) []*BlockHeader {
+	headers := make([]*BlockHeader, 0, count)
+	previousHash := ""
+	for i := 0; i < count; i++ {
+		block := NewBlock(i, 1, 1, fmt.Sprintf("block %d", i), previousHash)
+		block.Mine(DefaultPoW)
+		headers = append(headers, &block.BlockHeader)
+		previousHash = block.Hash
+	}
+	return headers
+}
+
+// copyHeaders copies the headers so that a test case can modify them
+func copyHeaders(headers []*BlockHeader) []*BlockHeader {
+	copies := make([]*BlockHeader, len(headers))
+	for i, header := range headers {
+		header := *header
+		copies[i] = &header
+	}
+	return copies
+}
+
+func TestValidateHeaderChain(t *testing.T) {
+	headers := mineHeaderChain(5)
+	if err := ValidateHeaderChain(DefaultPoW, fixedRules, headers); err != nil {
+		t.Fatalf("valid header chain rejected: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		length  int
+		modify  func(headers []*BlockHeader)
+		wantErr string
+	}{
+		{"empty chain", 0, func([]*BlockHeader) {}, "empty"},
+		{"no genesis", 5, func(h []*BlockHeader) { h[0].Index = 1; mineHeader(h[0]) }, "genesis"},
+		{"easy genesis", 1, func(h []*BlockHeader) { h[0].Difficulty = 0; mineHeader(h[0]) }, "at least 1"},
+		{"tampered hash", 5, func(h []*BlockHeader) { h[2].Nonce++ }, "hash mismatch"},
+		{"unsolved header", 5, func(h []*BlockHeader) { unsolveHeader(h[2]) }, "difficulty requirement"},
+		{"broken link", 5, func(h []*BlockHeader) { h[2].PreviousHash = "other"; mineHeader(h[2]) }, "previous hash"},
+		{"index gap", 5, func(h []*BlockHeader) { h[2].Index = 5; mineHeader(h[2]) }, "not sequential"},
+		{"wrong difficulty", 5, func(h []*BlockHeader) { h[2].Difficulty = 2; mineHeader(h[2]) }, "does not match expected"},
+		{"adjusted fixed difficulty", 5, func(h []*BlockHeader) { h[2].NextBlockDifficulty = 2; mineHeader(h[2]) }, "next block difficulty 2"},
+		{"zero next difficulty", 5, func(h []*BlockHeader) { h[2].NextBlockDifficulty = 0; mineHeader(h[2]) }, "below 1"},
+	}
+
+	for _, test := range tests {
+		modified := copyHeaders(headers[:test.length])
+		test.modify(modified)
+
+		err := ValidateHeaderChain(DefaultPoW, fixedRules, modified)
+		if err == nil {
+			t.Errorf("%s: header chain accepted", test.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: error %q does not mention %q", test.name, err, test.wantErr)
+		}
+	}
+}
+
+// timedHeaders returns unmined headers of the given difficulty found every
+// blockTime seconds
+func timedHeaders(count, difficulty int, blockTime int64) []*BlockHeader {
+	headers := make([]*BlockHeader, count)
+	for i := range headers {
+		headers[i] = &BlockHeader{
+			Index:               i,
+			Timestamp:           int64(i) * blockTime,
+			Difficulty:          difficulty,
+			NextBlockDifficulty: difficulty,
+		}
+	}
+	return headers
+}
+
+func TestNextDifficulty(t *testing.T) {
+	rules := DifficultyRules{AdjustmentBlocks: 4, TargetBlockTime: 10}
+
+	tests := []struct {
+		name       string
+		difficulty int
+		blockTime  int64
+		latest     int
+		want       int
+	}{
+		{"fast blocks", 3, 2, 4, 4},
+		{"slow blocks", 3, 20, 4, 2},
+		{"on target", 3, 10, 4, 3},
+		{"slow blocks at the minimum", 1, 20, 4, 1},
+		{"between adjustments", 3, 2, 5, 3},
+	}
+
+	for _, test := range tests {
+		headers := timedHeaders(test.latest+1, test.difficulty, test.blockTime)
+		if got := rules.NextDifficulty(headers[test.latest], headerSliceAt(headers)); got != test.want {
+			t.Errorf("%s: next difficulty %d, want %d", test.name, got, test.want)
+		}
+	}
+
+	// Fixed difficulties are never adjusted
+	rules.FixedDifficulty = 3
+	headers := timedHeaders(5, 3, 2)
+	if got := rules.NextDifficulty(headers[4], headerSliceAt(headers)); got != 3 {
+		t.Errorf("fixed difficulty adjusted to %d", got)
+	}
+}
+
+func TestValidateNextDifficulty(t *testing.T) {
+	rules := DifficultyRules{AdjustmentBlocks: 4, TargetBlockTime: 10}
+	headers := timedHeaders(6, 3, 2)
+	headerAt := headerSliceAt(headers)
+
+	// The block following an adjustment must commit the adjusted difficulty
+	next := *headers[5]
+	next.NextBlockDifficulty = 4
+	if err := rules.ValidateNextDifficulty(headers[4], &next, headerAt); err != nil {
+		t.Fatalf("adjusted difficulty rejected: %v", err)
+	}
+
+	next.NextBlockDifficulty = 3
+	if err := rules.ValidateNextDifficulty(headers[4], &next, headerAt); err == nil {
+		t.Fatal("unadjusted difficulty accepted")
+	}
+}
@@ -0,0 +1,229 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// membershipDataPrefix marks block data holding membership updates
+const membershipDataPrefix = "membership:"
+
+// MembershipAction is the kind of a membership update
+type MembershipAction string
+
+const (
+	MembershipAdd    MembershipAction = "add"
+	MembershipRemove MembershipAction = "remove"
+)
+
+// MembershipRole is the role granted or revoked by a membership update
+type MembershipRole string
+
+const (
+	// RoleMember may connect to the network
+	RoleMember MembershipRole = "member"
+	// RoleProducer may connect to the network and produce blocks
+	RoleProducer MembershipRole = "producer"
+)
+
+// MembershipUpdate adds or removes a node public key from a role. Updates are
+// recorded on chain in the data of blocks produced by current producers.
+type MembershipUpdate struct {
+	Action    MembershipAction `json:"action"`
+	Role      MembershipRole   `json:"role"`
+	PublicKey string           `json:"public_key"`
+}
+
+// Validate checks the format of the update
+func (u MembershipUpdate) Validate() error {
+	if u.Action != MembershipAdd && u.Action != MembershipRemove {
+		return fmt.Errorf("unknown membership action %q", u.Action)
+	}
+
+	if u.Role != RoleMember && u.Role != RoleProducer {
+		return fmt.Errorf("unknown membership role %q", u.Role)
+	}
+
+	if _, err := DecodePublicKey(u.PublicKey); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Membership is the set of node public keys allowed on a permissioned network
+type Membership struct {
+	members   map[string]bool
+	producers map[string]bool
+}
+
+// NewMembership creates a membership from base64 encoded public keys.
+// Producers are members as well.
+func NewMembership(members, producers []string) (*Membership, error) {
+	membership := &Membership{
+		members:   make(map[string]bool),
+		producers: make(map[string]bool),
+	}
+
+	for _, key := range members {
+		if _, err := DecodePublicKey(key); err != nil {
+			return nil, err
+		}
+		membership.members[key] = true
+	}
+
+	for _, key := range producers {
+		if _, err := DecodePublicKey(key); err != nil {
+			return nil, err
+		}
+		membership.members[key] = true
+		membership.producers[key] = true
+	}
+
+	if len(membership.producers) == 0 {
+		return nil, fmt.Errorf("membership needs at least one producer")
+	}
+
+	return membership, nil
+}
+
+// Clone returns a copy of the membership
+func (ms *Membership) Clone() *Membership {
+	clone := &Membership{
+		members:   make(map[string]bool, len(ms.members)),
+		producers: make(map[string]bool, len(ms.producers)),
+	}
+
+	for key := range ms.members {
+		clone.members[key] = true
+	}
+	for key := range ms.producers {
+		clone.producers[key] = true
+	}
+	return clone
+}
+
+// IsMember checks if a public key may connect to the network
+func (ms *Membership) IsMember(publicKey string) bool {
+	return ms.members[publicKey]
+}
+
+// IsProducer checks if a public key may produce blocks
+func (ms *Membership) IsProducer(publicKey string) bool {
+	return ms.producers[publicKey]
+}
+
+// Members returns the sorted public keys of all members
+func (ms *Membership) Members() []string {
+	return sortedKeys(ms.members)
+}
+
+// Producers returns the sorted public keys of the producers
+func (ms *Membership) Producers() []string {
+	return sortedKeys(ms.producers)
+}
+
+// IsApplied checks if the membership already reflects an update
+func (ms *Membership) IsApplied(update MembershipUpdate) bool {
+	set := ms.members
+	if update.Role == RoleProducer {
+		set = ms.producers
+	}
+
+	return set[update.PublicKey] == (update.Action == MembershipAdd)
+}
+
+// Apply applies an update. Removing a member also removes its producer role,
+// and granting the producer role also makes the key a member.
+func (ms *Membership) Apply(update MembershipUpdate) error {
+	if err := update.Validate(); err != nil {
+		return err
+	}
+
+	key := update.PublicKey
+	switch {
+	case update.Action == MembershipAdd:
+		ms.members[key] = true
+		if update.Role == RoleProducer {
+			ms.producers[key] = true
+		}
+	case update.Role == RoleProducer:
+		if ms.producers[key] && len(ms.producers) == 1 {
+			return fmt.Errorf("cannot remove the last producer")
+		}
+		delete(ms.producers, key)
+	default:
+		if ms.producers[key] && len(ms.producers) == 1 {
+			return fmt.Errorf("cannot remove the last producer")
+		}
+		delete(ms.members, key)
+		delete(ms.producers, key)
+	}
+
+	return nil
+}
+
+// ApplyBlock applies the membership updates recorded in a block
+func (ms *Membership) ApplyBlock(block *Block) error {
+	updates, err := ParseMembershipData(block.Data)
+	if err != nil {
+		return err
+	}
+
+	for _, update := range updates {
+		if err := ms.Apply(update); err != nil {
+			return fmt.Errorf("invalid membership update: %w", err)
+		}
+	}
+	return nil
+}
+
+// NewMembershipData encodes membership updates as block data
+func NewMembershipData(updates []MembershipUpdate) (string, error) {
+	data, err := json.Marshal(updates)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal membership updates: %w", err)
+	}
+	return membershipDataPrefix + string(data), nil
+}
+
+// ParseMembershipData decodes the membership updates of block data, if any
+func ParseMembershipData(data string) ([]MembershipUpdate, error) {
+	if !strings.HasPrefix(data, membershipDataPrefix) {
+		return nil, nil
+	}
+
+	var updates []MembershipUpdate
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(data, membershipDataPrefix)), &updates); err != nil {
+		return nil, fmt.Errorf("malformed membership data: %w", err)
+	}
+	return updates, nil
+}
+
+// EncodePublicKey encodes a node public key as used in memberships and block headers
+func EncodePublicKey(publicKey ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(publicKey)
+}
+
+// DecodePublicKey decodes a base64 encoded node public key
+func DecodePublicKey(key string) (ed25519.PublicKey, error) {
+	data, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(data) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key %q", key)
+	}
+	return ed25519.PublicKey(data), nil
+}
+
+// sortedKeys returns the keys of a set in order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
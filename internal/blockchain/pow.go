@@ -0,0 +1,118 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"sort"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Names of the proof-of-work functions
+const (
+	PoWSHA512       = "sha512"
+	PoWDoubleSHA256 = "sha256d"
+	PoWArgon2id     = "argon2id"
+)
+
+// Argon2id parameters, kept small enough to validate a long chain on sync
+const (
+	argon2Time    = 1
+	argon2Memory  = 1024 // KiB
+	argon2Threads = 1
+	argon2KeyLen  = 32
+)
+
+// argon2Salt separates the proof-of-work hashes from other Argon2id uses
+var argon2Salt = []byte("blockchain-go/pow")
+
+// PoW is a proof-of-work function hashing block headers. Hashes are base64
+// encoded, so that each leading zero required by the difficulty divides the
+// odds by 64 whatever the function.
+type PoW interface {
+	// Name returns the name of the function in the chain configuration
+	Name() string
+
+	// Hash hashes the serialized header
+	Hash(data []byte) string
+}
+
+// DefaultPoW is the proof-of-work function of chains that do not configure one
+var DefaultPoW PoW = SHA512PoW{}
+
+// powFunctions holds the proof-of-work functions by name
+var powFunctions = map[string]PoW{
+	PoWSHA512:       SHA512PoW{},
+	PoWDoubleSHA256: DoubleSHA256PoW{},
+	PoWArgon2id:     Argon2idPoW{},
+}
+
+// PoWByName returns the proof-of-work function of the given name, the default
+// one for an empty name
+func PoWByName(name string) (PoW, error) {
+	if name == "" {
+		return DefaultPoW, nil
+	}
+
+	pow, exists := powFunctions[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown proof-of-work function %q (available: %v)", name, PoWNames())
+	}
+	return pow, nil
+}
+
+// PoWNames returns the names of the available proof-of-work functions
+func PoWNames() []string {
+	names := make([]string, 0, len(powFunctions))
+	for name := range powFunctions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SHA512PoW hashes headers with SHA-512, the original function of the chain
+type SHA512PoW struct{}
+
+// Name returns the name of the function
+func (SHA512PoW) Name() string {
+	return PoWSHA512
+}
+
+// Hash hashes the serialized header
+func (SHA512PoW) Hash(data []byte) string {
+	sum := sha512.Sum512(data)
+	return base64.URLEncoding.EncodeToString(sum[:])
+}
+
+// DoubleSHA256PoW hashes headers with SHA-256 applied twice
+type DoubleSHA256PoW struct{}
+
+// Name returns the name of the function
+func (DoubleSHA256PoW) Name() string {
+	return PoWDoubleSHA256
+}
+
+// Hash hashes the serialized header
+func (DoubleSHA256PoW) Hash(data []byte) string {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return base64.URLEncoding.EncodeToString(second[:])
+}
+
+// Argon2idPoW hashes headers with the memory-hard Argon2id function, making
+// each hash cost memory bandwidth rather than only computation
+type Argon2idPoW struct{}
+
+// Name returns the name of the function
+func (Argon2idPoW) Name() string {
+	return PoWArgon2id
+}
+
+// Hash hashes the serialized header
+func (Argon2idPoW) Hash(data []byte) string {
+	key := argon2.IDKey(data, argon2Salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return base64.URLEncoding.EncodeToString(key)
+}
@@ -0,0 +1,56 @@
+package blockchain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPoWByName(t *testing.T) {
+	pow, err := PoWByName("")
+	if err != nil || pow != DefaultPoW {
+		t.Fatalf("empty name gave %v (%v), want the default function", pow, err)
+	}
+
+	for _, name := range PoWNames() {
+		pow, err := PoWByName(name)
+		if err != nil {
+			t.Fatalf("available function %s rejected: %v", name, err)
+		}
+		if pow.Name() != name {
+			t.Fatalf("function %s is named %s", name, pow.Name())
+		}
+	}
+
+	// Names are matched exactly and errors list the available functions
+	for _, name := range []string{"scrypt", "SHA512", " sha512"} {
+		_, err := PoWByName(name)
+		if err == nil {
+			t.Fatalf("unknown function %q accepted", name)
+		}
+		for _, available := range PoWNames() {
+			if !strings.Contains(err.Error(), available) {
+				t.Fatalf("error %q does not list function %s", err, available)
+			}
+		}
+	}
+}
+
+func TestPoWFunctionsDiffer(t *testing.T) {
+	for _, name := range PoWNames() {
+		pow, _ := PoWByName(name)
+		block := NewBlock(0, 1, 1, "Genesis Block", "")
+		block.Mine(pow)
+
+		if err := block.IsValid(pow); err != nil {
+			t.Fatalf("block mined with %s is invalid: %v", name, err)
+		}
+
+		// The hash of another function does not match the header
+		for _, other := range PoWNames() {
+			otherPoW, _ := PoWByName(other)
+			if other != name && block.IsValid(otherPoW) == nil {
+				t.Fatalf("block mined with %s is valid with %s", name, other)
+			}
+		}
+	}
+}
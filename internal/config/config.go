@@ -11,24 +11,103 @@ type Config struct {
 	Blockchain BlockchainConfig `mapstructure:"blockchain"`
 	Network    NetworkConfig    `mapstructure:"network"`
 	Miner      MinerConfig      `mapstructure:"miner"`
+	API        APIConfig        `mapstructure:"api"`
+	Pool       PoolConfig       `mapstructure:"pool"`
+	Permission PermissionConfig `mapstructure:"permission"`
 }
 
 // BlockchainConfig holds blockchain-specific configuration
 type BlockchainConfig struct {
-	DifficultyCalculationBlocks int `mapstructure:"difficulty_calculation_blocks"`
-	TargetBlockTime             int `mapstructure:"target_block_time"`
+	DifficultyCalculationBlocks int    `mapstructure:"difficulty_calculation_blocks"`
+	TargetBlockTime             int    `mapstructure:"target_block_time"`
+	GenesisHash                 string `mapstructure:"genesis_hash"`
+
+	// PoW names the proof-of-work function of the chain: sha512, sha256d or argon2id
+	PoW string `mapstructure:"pow"`
+
+	// Regtest runs a test chain with a trivial fixed difficulty where blocks
+	// are only mined on demand through the generate command
+	Regtest bool `mapstructure:"regtest"`
 }
 
 // NetworkConfig holds network-specific configuration
 type NetworkConfig struct {
-	Host string `mapstructure:"host"`
-	Port int    `mapstructure:"port"`
+	Host                 string   `mapstructure:"host"`
+	Port                 int      `mapstructure:"port"`
+	PingInterval         int      `mapstructure:"ping_interval"`
+	MaxPeerFailures      int      `mapstructure:"max_peer_failures"`
+	BanThreshold         int      `mapstructure:"ban_threshold"`
+	BanDuration          int      `mapstructure:"ban_duration"`
+	BanFile              string   `mapstructure:"ban_file"`
+	MaxBroadcastHops     int      `mapstructure:"max_broadcast_hops"`
+	BroadcastCacheTTL    int      `mapstructure:"broadcast_cache_ttl"`
+	BroadcastCacheSize   int      `mapstructure:"broadcast_cache_size"`
+	SeedPeers            []string `mapstructure:"seed_peers"`
+	DownloadWindowSize   int      `mapstructure:"download_window_size"`
+	DownloadStallTimeout int      `mapstructure:"download_stall_timeout"`
+	Encryption           bool     `mapstructure:"encryption"`
+	IdentityFile         string   `mapstructure:"identity_file"`
+	MaxInboundPeers      int      `mapstructure:"max_inbound_peers"`
+	MaxOutboundPeers     int      `mapstructure:"max_outbound_peers"`
+	MaxPeersPerIP        int      `mapstructure:"max_peers_per_ip"`
+	MaxPeersPerSubnet    int      `mapstructure:"max_peers_per_subnet"`
+	MaxConnections       int      `mapstructure:"max_connections"`
+	PeerMessageRate      float64  `mapstructure:"peer_message_rate"`
+	PeerMessageBurst     int      `mapstructure:"peer_message_burst"`
+	MaxUploadRate        int      `mapstructure:"max_upload_rate"`
+	Codec                string   `mapstructure:"codec"`
+
+	// MessageRateLimits maps lowercase packet names to their rate limit
+	MessageRateLimits map[string]RateLimitConfig `mapstructure:"message_rate_limits"`
+}
+
+// RateLimitConfig holds a token bucket rate limit
+type RateLimitConfig struct {
+	Rate  float64 `mapstructure:"rate"`
+	Burst int     `mapstructure:"burst"`
 }
 
 // MinerConfig holds miner-specific configuration
 type MinerConfig struct {
+	// Enabled starts mining with the node, otherwise the miner waits to be
+	// started through the admin API
+	Enabled bool `mapstructure:"enabled"`
+
 	NetworkSyncInterval int `mapstructure:"network_sync_interval"`
 	MaxNonce            int `mapstructure:"max_nonce"`
+
+	// Workers is the number of mining goroutines, 0 uses one per CPU
+	Workers int `mapstructure:"workers"`
+
+	// DutyCycle is the percentage of the time the workers hash, from 1 to 100
+	DutyCycle int `mapstructure:"duty_cycle"`
+}
+
+// APIConfig holds admin API configuration
+type APIConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Host    string `mapstructure:"host"`
+	Port    int    `mapstructure:"port"`
+}
+
+// PoolConfig holds mining pool configuration
+type PoolConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Host    string `mapstructure:"host"`
+	Port    int    `mapstructure:"port"`
+
+	// ShareDifficulty is the number of leading zeros of accepted shares
+	ShareDifficulty int `mapstructure:"share_difficulty"`
+
+	// JobRefresh is the interval in seconds between two jobs on the same tip
+	JobRefresh int `mapstructure:"job_refresh"`
+}
+
+// PermissionConfig holds the permissioned network configuration
+type PermissionConfig struct {
+	Enabled   bool     `mapstructure:"enabled"`
+	Members   []string `mapstructure:"members"`
+	Producers []string `mapstructure:"producers"`
 }
 
 // Load reads configuration from file
@@ -40,12 +119,13 @@ func Load(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
+	// Start from defaults so that missing keys keep sensible values
+	config := Default()
+	if err := viper.Unmarshal(config); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
-	return &config, nil
+	return config, nil
 }
 
 // Default returns default configuration
@@ -54,14 +134,61 @@ func Default() *Config {
 		Blockchain: BlockchainConfig{
 			DifficultyCalculationBlocks: 50,
 			TargetBlockTime:             20,
+			PoW:                         "sha512",
 		},
 		Network: NetworkConfig{
-			Host: "127.0.0.1",
-			Port: 8080,
+			Host:                 "127.0.0.1",
+			Port:                 8080,
+			PingInterval:         10,
+			MaxPeerFailures:      3,
+			BanThreshold:         100,
+			BanDuration:          86400,
+			BanFile:              "bans.json",
+			MaxBroadcastHops:     8,
+			BroadcastCacheTTL:    600,
+			BroadcastCacheSize:   10000,
+			DownloadWindowSize:   100,
+			DownloadStallTimeout: 15,
+			Encryption:           true,
+			IdentityFile:         "node.key",
+			MaxInboundPeers:      32,
+			MaxOutboundPeers:     8,
+			MaxPeersPerIP:        2,
+			MaxPeersPerSubnet:    8,
+			MaxConnections:       128,
+			PeerMessageRate:      50,
+			PeerMessageBurst:     200,
+			MaxUploadRate:        0,
+			Codec:                "binary",
+			MessageRateLimits: map[string]RateLimitConfig{
+				"downloadblock": {Rate: 1, Burst: 5},
+				"getheaders":    {Rate: 5, Burst: 20},
+				"getdata":       {Rate: 20, Burst: 100},
+				"join":          {Rate: 0.1, Burst: 3},
+				"ping":          {Rate: 1, Burst: 5},
+			},
 		},
 		Miner: MinerConfig{
+			Enabled:             true,
 			NetworkSyncInterval: 1,
 			MaxNonce:            4294967296,
+			Workers:             0,
+			DutyCycle:           100,
+		},
+		API: APIConfig{
+			Enabled: true,
+			Host:    "127.0.0.1",
+			Port:    9080,
+		},
+		Pool: PoolConfig{
+			Enabled:         false,
+			Host:            "127.0.0.1",
+			Port:            3333,
+			ShareDifficulty: 3,
+			JobRefresh:      30,
+		},
+		Permission: PermissionConfig{
+			Enabled: false,
 		},
 	}
 }
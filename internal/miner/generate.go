@@ -0,0 +1,43 @@
+package miner
+
+import (
+	"blockchain-go/internal/blockchain"
+	"fmt"
+)
+
+// Generate mines the given number of blocks one after the other on a single
+// goroutine and submits them to the work source, returning their hashes. A
+// non-empty address is recorded as the data of the blocks. It is meant for
+// chains with a trivial difficulty, such as regtest chains.
+func Generate(source WorkSource, count int, address string) ([]string, error) {
+	hashes := make([]string, 0, count)
+
+	for len(hashes) < count {
+		template, err := source.GetBlockTemplate()
+		if err != nil {
+			return hashes, fmt.Errorf("failed to get block template: %w", err)
+		}
+
+		pow, err := template.ProofOfWork()
+		if err != nil {
+			return hashes, err
+		}
+
+		block := template.Block()
+		if address != "" {
+			block.Data = address
+			block.DataHash = blockchain.ComputeDataHash(address)
+		}
+
+		if found, _ := block.MineRange(pow, 0, blockchain.DefaultMaxNonce, 1, nil); !found {
+			return hashes, fmt.Errorf("failed to mine block #%d", block.Index)
+		}
+
+		if err := source.SubmitBlock(block); err != nil {
+			return hashes, fmt.Errorf("failed to submit block #%d: %w", block.Index, err)
+		}
+		hashes = append(hashes, block.Hash)
+	}
+
+	return hashes, nil
+}
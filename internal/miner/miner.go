@@ -4,24 +4,65 @@ import (
 	"blockchain-go/internal/blockchain"
 	"blockchain-go/internal/config"
 	"blockchain-go/internal/network"
+	"context"
+	"errors"
+	"fmt"
 	"log"
-	"strconv"
+	"sync"
 	"time"
 )
 
+// States of a miner
+const (
+	StateMining  = "mining"
+	StatePaused  = "paused"
+	StateStopped = "stopped"
+)
+
+// Status describes the state of a miner and the template it is mining
+type Status struct {
+	State     string         `json:"state"`
+	Workers   int            `json:"workers"`
+	DutyCycle int            `json:"duty_cycle"`
+	HashRates HashRates      `json:"hash_rates"`
+	Template  *BlockTemplate `json:"template,omitempty"`
+}
+
 // Miner represents the mining process
 type Miner struct {
-	networkManager *network.Manager
-	config         config.MinerConfig
-	stopChan       chan struct{}
+	source   WorkSource
+	config   config.MinerConfig
+	stopChan chan struct{}
+	stopOnce sync.Once
+
+	// Runtime controls, guarded by mu. Changes are signaled on changed so
+	// that the template being mined is abandoned.
+	mu       sync.Mutex
+	workers  *workerPool
+	pending  *workerPool // replaces workers once the running solve returns
+	solving  bool
+	stats    *Stats
+	paused   bool
+	stopped  bool
+	template *BlockTemplate
+	changed  chan struct{}
 }
 
-// NewMiner creates a new miner instance
+// NewMiner creates a new miner instance mining for the node of the given network manager
 func NewMiner(nm *network.Manager, cfg config.MinerConfig) *Miner {
+	return NewMinerWithSource(NewLocalWorkSource(nm), cfg)
+}
+
+// NewMinerWithSource creates a new miner instance mining templates of the given work source
+func NewMinerWithSource(source WorkSource, cfg config.MinerConfig) *Miner {
 	return &Miner{
-		networkManager: nm,
-		config:         cfg,
-		stopChan:       make(chan struct{}),
+		source:   source,
+		config:   cfg,
+		workers:  newWorkerPool(cfg.Workers, cfg.MaxNonce, cfg.DutyCycle),
+		stats:    newStats(),
+		paused:   !cfg.Enabled,
+		stopChan: make(chan struct{}),
+		changed:  make(chan struct{}, 1),
 	}
 }
 
@@ -31,114 +72,383 @@ func Start(nm *network.Manager, cfg config.MinerConfig) {
 	miner.Start()
 }
 
-// Start begins the mining process
+// Start begins the mining process, which runs until Stop is called. A paused
+// miner waits for Resume before mining.
 func (m *Miner) Start() {
-	log.Println("Starting miner...")
+	if m.IsPaused() {
+		log.Println("Starting miner paused...")
+	} else {
+		log.Printf("Starting miner with %d workers...", m.getWorkers().size())
+	}
+
+	syncInterval := time.Duration(m.config.NetworkSyncInterval) * time.Second
+	lastReport := time.Now()
 
-	mineCount := 0
-	startTime := time.Now()
-	restart := false
+	// Time-to-find is measured from the first template on the same parent
+	var parentHash string
+	var parentStart time.Time
+
+	// Abandon the current template as soon as the tip changes, when the work
+	// source announces tip changes
+	var tips <-chan *blockchain.Block
+	if notifier, ok := m.source.(TipNotifier); ok {
+		var unsubscribe func()
+		tips, unsubscribe = notifier.SubscribeTip()
+		defer unsubscribe()
+	}
 
 	for {
 		select {
 		case <-m.stopChan:
+			m.mu.Lock()
+			m.stopped = true
+			m.mu.Unlock()
+
 			log.Println("Miner stopped")
 			return
 		default:
-			restart = false
+			// Wait for mining to be resumed
+			if m.IsPaused() {
+				select {
+				case <-m.changed:
+				case <-m.stopChan:
+				}
+				parentHash = ""
+				continue
+			}
 
-			// Get latest block
-			latestBlock, err := m.networkManager.GetBlockchain().GetLatestBlock()
+			// Get a new block on top of the latest block
+			template, err := m.source.GetBlockTemplate()
+			if errors.Is(err, ErrNotProducer) {
+				m.sleep(syncInterval)
+				continue
+			}
 			if err != nil {
-				time.Sleep(1 * time.Second)
+				log.Printf("Failed to get block template: %v", err)
+				m.sleep(1 * time.Second)
 				continue
 			}
 
-			// Calculate next block difficulty
-			nextBlockDifficulty := latestBlock.NextBlockDifficulty
-			if m.networkManager.GetBlockchain().ShouldRecalculateDifficulty() {
-				newDifficulty, err := m.networkManager.GetBlockchain().CalculateNewDifficulty()
-				if err != nil {
-					log.Printf("Failed to calculate new difficulty: %v", err)
-				} else {
-					nextBlockDifficulty = newDifficulty
-					log.Printf("New difficulty: %d", newDifficulty)
-				}
+			pow, err := template.ProofOfWork()
+			if err != nil {
+				log.Printf("Failed to mine block template: %v", err)
+				m.sleep(syncInterval)
+				continue
 			}
 
-			// Ensure minimum difficulty
-			difficultyForThisBlock := latestBlock.NextBlockDifficulty
-			if difficultyForThisBlock < 1 {
-				difficultyForThisBlock = 1
+			if template.PreviousHash != parentHash {
+				parentHash = template.PreviousHash
+				parentStart = time.Now()
 			}
 
-			// Create new block
-			block := blockchain.NewBlock(
-				latestBlock.Index+1,
-				difficultyForThisBlock,
-				nextBlockDifficulty,
-				"data",
-				latestBlock.Hash,
-			)
-
-			// Mine the block
-			for !block.IsHashValid(block.Hash) && !restart {
-				block.Timestamp = time.Now().Unix()
-				block.Nonce = int(time.Now().UnixNano() % int64(m.config.MaxNonce))
-				block.Hash = block.ComputeHash()
-
-				mineCount++
-
-				// Check if we should sync with network
-				if time.Since(startTime) > time.Duration(m.config.NetworkSyncInterval)*time.Second {
-					restart = true
-
-					timeSinceLastMiningRateCalc := time.Since(startTime)
-					hashRate := float64(mineCount) / timeSinceLastMiningRateCalc.Seconds()
-					log.Printf("Mining rate: %.2f H/s", hashRate)
-
-					mineCount = 0
-					startTime = time.Now()
-				}
+			// Mine the block until the tip changes, refreshing the template
+			// once per sync interval
+			m.setTemplate(template)
+			block := m.solve(template, pow, tips, syncInterval)
+			m.setTemplate(nil)
+
+			// Report hash rates once per sync interval
+			if time.Since(lastReport) > syncInterval {
+				rates, hashes := m.getWorkers().measure()
+				m.stats.recordHashes(hashes)
+				log.Printf("Mining rate: %.2f H/s (per worker: %s)", rates.Total, rates.String())
+				lastReport = time.Now()
 			}
 
-			// Add mined block to blockchain
-			if !restart {
-				if err := m.networkManager.GetBlockchain().AddBlock(block); err != nil {
-					log.Printf("Failed to add block: %v", err)
-				} else {
+			// Submit mined block
+			if block != nil {
+				err := m.source.SubmitBlock(block)
+				switch {
+				case errors.Is(err, ErrStaleBlock):
+					m.stats.recordStale()
+					log.Printf("Failed to submit block: %v", err)
+				case err != nil:
+					m.stats.recordRejected()
+					log.Printf("Failed to submit block: %v", err)
+				default:
+					m.stats.recordFound(block, time.Since(parentStart))
 					log.Printf("Mined block #%d (Hash: %s, Nonce: %d)",
 						block.Index, block.Hash, block.Nonce)
+				}
+			}
+		}
+	}
+}
+
+// solve mines the template with every worker for at most the given duration,
+// returning nil if no solution was found, a new tip arrived or the miner was stopped
+func (m *Miner) solve(template *BlockTemplate, pow blockchain.PoW, tips <-chan *blockchain.Block, timeout time.Duration) *blockchain.Block {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	watcherDone := make(chan struct{})
+	go func() {
+		defer close(watcherDone)
 
-					// Broadcast found block
-					m.broadcastFoundBlock(block.Index)
+		for {
+			select {
+			case <-m.stopChan:
+				cancel()
+				return
+			case <-m.changed:
+				// Pick up the new controls with a new template
+				cancel()
+				return
+			case tip := <-tips:
+				// Our own template builds on the tip we already know
+				if tip.Hash != template.PreviousHash {
+					log.Printf("New tip #%d, abandoning template #%d", tip.Index, template.Index)
+					cancel()
+					return
 				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Work sources accepting shares get every hash meeting the share difficulty
+	var share func(*blockchain.Block)
+	if submitter, ok := m.source.(ShareSubmitter); ok && template.ShareDifficulty > 0 {
+		share = func(block *blockchain.Block) {
+			if err := submitter.SubmitShare(block); err != nil {
+				log.Printf("Share rejected: %v", err)
 			}
 		}
 	}
+
+	block := m.beginSolve().solve(ctx, pow, template.Block(), template.ShareDifficulty, share)
+	m.endSolve()
+
+	// Wait for the watcher to exit so that a tip it consumed is always older
+	// than the next template
+	cancel()
+	<-watcherDone
+
+	return block
 }
 
-// Stop stops the mining process
-func (m *Miner) Stop() {
-	close(m.stopChan)
+// GetHashRates returns the per-worker and total hash rates measured over the
+// last network sync interval
+func (m *Miner) GetHashRates() HashRates {
+	return m.getWorkers().lastRates()
 }
 
-// broadcastFoundBlock broadcasts a found block to the network
-func (m *Miner) broadcastFoundBlock(blockIndex int) {
-	blockIndexStr := strconv.Itoa(blockIndex)
-	packet := network.NewBroadcastPacket(
-		m.networkManager.GetMe(),
-		network.PacketNameFoundBlock,
-		[]byte(blockIndexStr),
-		blockIndex,
-	)
+// Stats returns the mining statistics. Given the chain of the node, they also
+// count orphaned blocks and estimate the network hash rate.
+func (m *Miner) Stats(bc *blockchain.Blockchain) StatsSnapshot {
+	return m.stats.Snapshot(bc)
+}
+
+// Status returns the state of the miner and the template it is mining
+func (m *Miner) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := Status{
+		State:     StateMining,
+		Workers:   m.nextWorkers().size(),
+		DutyCycle: m.nextWorkers().getDutyCycle(),
+		HashRates: m.workers.lastRates(),
+	}
+
+	switch {
+	case m.stopped:
+		status.State = StateStopped
+	case m.paused:
+		status.State = StatePaused
+	}
+
+	// Rates measured before pausing are no longer current
+	if status.State != StateMining {
+		status.HashRates = HashRates{Workers: make([]float64, m.nextWorkers().size())}
+	}
+
+	if m.template != nil {
+		template := *m.template
+		status.Template = &template
+	}
+	return status
+}
+
+// IsPaused checks if mining is paused
+func (m *Miner) IsPaused() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.paused
+}
+
+// Pause stops mining until Resume is called, abandoning the current template
+func (m *Miner) Pause() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	packetData, err := packet.ToJSON()
+	if !m.paused {
+		m.paused = true
+		m.signalChange()
+		log.Println("Mining paused")
+	}
+}
+
+// Resume restarts mining after Pause
+func (m *Miner) Resume() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.paused {
+		m.paused = false
+		m.signalChange()
+		log.Println("Mining resumed")
+	}
+}
+
+// SetWorkers changes the number of mining goroutines, one per CPU if 0. The
+// current template is abandoned and mined again by the new workers, which
+// replace the previous ones once they have all returned.
+func (m *Miner) SetWorkers(workers int) error {
+	if workers < 0 || workers > maxWorkers {
+		return fmt.Errorf("number of workers %d is not between 0 and %d", workers, maxWorkers)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pool := newWorkerPool(workers, m.config.MaxNonce, m.nextWorkers().getDutyCycle())
+	if m.solving {
+		m.pending = pool
+		m.signalChange()
+	} else {
+		m.replaceWorkers(pool)
+	}
+	log.Printf("Mining with %d workers", pool.size())
+	return nil
+}
+
+// SetDutyCycle changes the percentage of the time the workers hash, from 1
+// to 100. Workers sleep the rest of the time, reducing the CPU usage.
+func (m *Miner) SetDutyCycle(dutyCycle int) error {
+	if dutyCycle < 1 || dutyCycle > 100 {
+		return fmt.Errorf("duty cycle %d is not between 1 and 100", dutyCycle)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.workers.setDutyCycle(dutyCycle)
+	if m.pending != nil {
+		m.pending.setDutyCycle(dutyCycle)
+	}
+	log.Printf("Mining duty cycle set to %d%%", dutyCycle)
+	return nil
+}
+
+// getWorkers returns the current worker pool
+func (m *Miner) getWorkers() *workerPool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.workers
+}
+
+// beginSolve returns the worker pool mining the next template, which is kept
+// until endSolve is called
+func (m *Miner) beginSolve() *workerPool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.solving = true
+	return m.workers
+}
+
+// endSolve switches to the worker pool set while the workers were mining, if any
+func (m *Miner) endSolve() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.solving = false
+	if m.pending != nil {
+		m.replaceWorkers(m.pending)
+		m.pending = nil
+	}
+}
+
+// replaceWorkers switches to a new worker pool once the previous one stopped
+// hashing (internal use, requires the lock)
+func (m *Miner) replaceWorkers(pool *workerPool) {
+	// Keep the hashes of the previous workers in the statistics
+	_, hashes := m.workers.measure()
+	m.stats.recordHashes(hashes)
+
+	m.workers = pool
+}
+
+// nextWorkers returns the worker pool mining the next template (internal use,
+// requires the lock)
+func (m *Miner) nextWorkers() *workerPool {
+	if m.pending != nil {
+		return m.pending
+	}
+	return m.workers
+}
+
+// setTemplate records the template being mined
+func (m *Miner) setTemplate(template *BlockTemplate) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.template = template
+}
+
+// signalChange wakes up the mining loop after a control change (internal use, requires the lock)
+func (m *Miner) signalChange() {
+	select {
+	case m.changed <- struct{}{}:
+	default:
+	}
+}
+
+// sleep waits for the given duration, returning early when the miner is stopped
+func (m *Miner) sleep(d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-m.stopChan:
+	}
+}
+
+// NewBlockTemplate creates the next block to mine on top of the latest block of the chain
+func NewBlockTemplate(bc *blockchain.Blockchain, data string) (*blockchain.Block, error) {
+	snapshot, err := bc.GetTipSnapshot()
 	if err != nil {
-		log.Printf("Failed to serialize found block packet: %v", err)
-		return
+		return nil, err
+	}
+	return NewBlockFromTip(snapshot, data), nil
+}
+
+// NewBlockFromTip creates the next block to mine on top of the tip of a chain snapshot
+func NewBlockFromTip(snapshot *blockchain.TipSnapshot, data string) *blockchain.Block {
+	latestBlock := snapshot.Tip
+
+	nextBlockDifficulty := snapshot.NextBlockDifficulty
+	if nextBlockDifficulty != latestBlock.NextBlockDifficulty {
+		log.Printf("New difficulty: %d", nextBlockDifficulty)
 	}
 
-	m.networkManager.Broadcast(packetData)
-	log.Printf("Broadcasted found block #%d", blockIndex)
+	// Ensure minimum difficulty
+	difficultyForThisBlock := latestBlock.NextBlockDifficulty
+	if difficultyForThisBlock < 1 {
+		difficultyForThisBlock = 1
+	}
+
+	return blockchain.NewBlock(
+		latestBlock.Index+1,
+		difficultyForThisBlock,
+		nextBlockDifficulty,
+		data,
+		latestBlock.Hash,
+	)
+}
+
+// Stop stops the mining process. The block being mined is abandoned
+// immediately, every worker returning within a few hundred hashes. Stopping
+// a stopped miner has no effect.
+func (m *Miner) Stop() {
+	m.stopOnce.Do(func() { close(m.stopChan) })
 }
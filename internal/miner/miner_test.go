@@ -0,0 +1,170 @@
+package miner
+
+import (
+	"blockchain-go/internal/blockchain"
+	"blockchain-go/internal/config"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// unsolvableSource hands out templates too hard to be solved and counts them
+type unsolvableSource struct {
+	mu        sync.Mutex
+	templates int
+}
+
+func (s *unsolvableSource) GetBlockTemplate() (*BlockTemplate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.templates++
+	return NewTemplateFromBlock(blockchain.NewBlock(1, 64, 64, "data", "previous")), nil
+}
+
+func (s *unsolvableSource) SubmitBlock(block *blockchain.Block) error {
+	return nil
+}
+
+// getTemplates returns the number of templates handed out
+func (s *unsolvableSource) getTemplates() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.templates
+}
+
+// testMinerConfig returns the configuration of a miner with the given number
+// of workers, refreshing its template once per minute
+func testMinerConfig(workers int, enabled bool) config.MinerConfig {
+	cfg := config.Default().Miner
+	cfg.Enabled = enabled
+	cfg.Workers = workers
+	cfg.DutyCycle = 100
+	cfg.NetworkSyncInterval = 60
+	return cfg
+}
+
+// waitFor polls a condition until it holds
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSetWorkersWaitsForSolve(t *testing.T) {
+	m := NewMinerWithSource(&unsolvableSource{}, testMinerConfig(2, false))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pow := &recordingPoW{limit: 100, cancel: cancel}
+
+	running := m.beginSolve()
+	if err := m.SetWorkers(4); err != nil {
+		t.Fatalf("failed to set workers: %v", err)
+	}
+
+	// The running workers are kept until they return, the status already
+	// describes the next ones
+	if m.getWorkers() != running {
+		t.Fatal("workers replaced while solving")
+	}
+	if status := m.Status(); status.Workers != 4 {
+		t.Fatalf("status reports %d workers, want 4", status.Workers)
+	}
+
+	running.solve(ctx, pow, blockchain.NewBlock(7, 64, 64, "data", "p"), 0, nil)
+	m.endSolve()
+
+	if workers := m.getWorkers(); workers == running || workers.size() != 4 {
+		t.Fatal("workers not replaced after solving")
+	}
+	if hashes := m.Stats(nil).Hashes; hashes != uint64(len(pow.hashed)) {
+		t.Fatalf("statistics count %d hashes of the replaced workers, want %d", hashes, len(pow.hashed))
+	}
+}
+
+func TestSetWorkersWhenIdle(t *testing.T) {
+	m := NewMinerWithSource(&unsolvableSource{}, testMinerConfig(2, false))
+
+	if err := m.SetDutyCycle(50); err != nil {
+		t.Fatalf("failed to set duty cycle: %v", err)
+	}
+	if err := m.SetWorkers(3); err != nil {
+		t.Fatalf("failed to set workers: %v", err)
+	}
+
+	workers := m.getWorkers()
+	if workers.size() != 3 || workers.getDutyCycle() != 50 {
+		t.Fatalf("%d workers at duty cycle %d, want 3 at 50", workers.size(), workers.getDutyCycle())
+	}
+
+	if err := m.SetWorkers(maxWorkers + 1); err == nil {
+		t.Fatal("number of workers above the maximum accepted")
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	source := &unsolvableSource{}
+	m := NewMinerWithSource(source, testMinerConfig(2, false))
+
+	done := make(chan struct{})
+	go func() {
+		m.Start()
+		close(done)
+	}()
+
+	// A disabled miner starts paused
+	if status := m.Status(); status.State != StatePaused {
+		t.Fatalf("disabled miner is %s, want %s", status.State, StatePaused)
+	}
+
+	m.Resume()
+	waitFor(t, "a template to be mined", func() bool {
+		status := m.Status()
+		return status.State == StateMining && status.Template != nil
+	})
+
+	// Resizing abandons the template, which is mined again by the new workers
+	templates := source.getTemplates()
+	if err := m.SetWorkers(3); err != nil {
+		t.Fatalf("failed to set workers: %v", err)
+	}
+	waitFor(t, "the new workers", func() bool {
+		return m.getWorkers().size() == 3 && source.getTemplates() > templates
+	})
+
+	m.Pause()
+	waitFor(t, "the template to be abandoned", func() bool {
+		status := m.Status()
+		return status.State == StatePaused && status.Template == nil
+	})
+
+	templates = source.getTemplates()
+	time.Sleep(50 * time.Millisecond)
+	if source.getTemplates() != templates {
+		t.Fatal("paused miner requested templates")
+	}
+
+	m.Resume()
+	waitFor(t, "mining to resume", func() bool {
+		return source.getTemplates() > templates
+	})
+
+	m.Stop()
+	m.Stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("miner still running after Stop")
+	}
+	if status := m.Status(); status.State != StateStopped {
+		t.Fatalf("stopped miner is %s, want %s", status.State, StateStopped)
+	}
+}
@@ -0,0 +1,82 @@
+package miner
+
+import (
+	"blockchain-go/internal/blockchain"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// remoteTimeout is the timeout of requests to the admin API of a node
+const remoteTimeout = 10 * time.Second
+
+// RemoteWorkSource is the work source of a node reached through its admin API,
+// used to mine in a separate process
+type RemoteWorkSource struct {
+	url    string
+	client *http.Client
+}
+
+// NewRemoteWorkSource creates a work source for the admin API at the given base URL
+func NewRemoteWorkSource(url string) *RemoteWorkSource {
+	return &RemoteWorkSource{
+		url:    strings.TrimSuffix(url, "/"),
+		client: &http.Client{Timeout: remoteTimeout},
+	}
+}
+
+// GetBlockTemplate requests a template of the next block from the node
+func (s *RemoteWorkSource) GetBlockTemplate() (*BlockTemplate, error) {
+	response, err := s.client.Get(s.url + "/mining/template")
+	if err != nil {
+		return nil, fmt.Errorf("failed to request block template: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusForbidden {
+		return nil, ErrNotProducer
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, remoteError(response)
+	}
+
+	var template BlockTemplate
+	if err := json.NewDecoder(response.Body).Decode(&template); err != nil {
+		return nil, fmt.Errorf("failed to decode block template: %w", err)
+	}
+	return &template, nil
+}
+
+// SubmitBlock sends a solved block to the node
+func (s *RemoteWorkSource) SubmitBlock(block *blockchain.Block) error {
+	response, err := s.client.Post(s.url+"/mining/submit", "application/json", bytes.NewReader(block.ToJSON()))
+	if err != nil {
+		return fmt.Errorf("failed to submit block: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusConflict {
+		return ErrStaleBlock
+	}
+	if response.StatusCode != http.StatusOK {
+		return remoteError(response)
+	}
+	return nil
+}
+
+// remoteError returns the error reported by the admin API
+func remoteError(response *http.Response) error {
+	var body struct {
+		Error string `json:"error"`
+	}
+
+	data, _ := io.ReadAll(io.LimitReader(response.Body, 64*1024))
+	if err := json.Unmarshal(data, &body); err != nil || body.Error == "" {
+		return fmt.Errorf("node answered %s", response.Status)
+	}
+	return fmt.Errorf("node answered %s: %s", response.Status, body.Error)
+}
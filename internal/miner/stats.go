@@ -0,0 +1,186 @@
+package miner
+
+import (
+	"blockchain-go/internal/blockchain"
+	"sync"
+	"time"
+)
+
+// statsWindows are the sliding windows over which hash rates are averaged
+var statsWindows = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"1m", time.Minute},
+	{"5m", 5 * time.Minute},
+	{"15m", 15 * time.Minute},
+}
+
+// maxFoundBlocks is the number of found blocks kept to detect orphans
+const maxFoundBlocks = 1000
+
+// networkHashRateBlocks is the number of blocks the network hash rate is estimated from
+const networkHashRateBlocks = 120
+
+// FoundBlock describes a block found by the miner
+type FoundBlock struct {
+	Index      int       `json:"index"`
+	Hash       string    `json:"hash"`
+	FoundAt    time.Time `json:"found_at"`
+	TimeToFind float64   `json:"time_to_find"`
+}
+
+// StatsSnapshot holds the mining statistics at a point in time. Times are in
+// seconds and hash rates in hashes per second.
+type StatsSnapshot struct {
+	HashRates         map[string]float64 `json:"hash_rates"`
+	Hashes            uint64             `json:"hashes"`
+	BlocksFound       int                `json:"blocks_found"`
+	StaleBlocks       int                `json:"stale_blocks"`
+	RejectedBlocks    int                `json:"rejected_blocks"`
+	OrphanedBlocks    int                `json:"orphaned_blocks"`
+	LastBlock         *FoundBlock        `json:"last_block,omitempty"`
+	AverageTimeToFind float64            `json:"average_time_to_find"`
+	NetworkHashRate   float64            `json:"network_hash_rate"`
+	NetworkShare      float64            `json:"network_share"`
+}
+
+// hashSample counts the hashes computed until a point in time
+type hashSample struct {
+	at     time.Time
+	hashes uint64
+}
+
+// Stats records the hashes computed and the blocks found by a miner
+type Stats struct {
+	mu         sync.Mutex
+	started    time.Time
+	samples    []hashSample
+	hashes     uint64
+	found      []FoundBlock
+	foundTotal int
+	stale      int
+	rejected   int
+	timeToFind time.Duration
+}
+
+// newStats creates empty statistics
+func newStats() *Stats {
+	return &Stats{started: time.Now()}
+}
+
+// recordHashes records hashes computed until now
+func (s *Stats) recordHashes(hashes uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.hashes += hashes
+	s.samples = append(s.samples, hashSample{at: now, hashes: hashes})
+
+	// Drop the samples older than the longest window
+	longest := statsWindows[len(statsWindows)-1].duration
+	expired := 0
+	for expired < len(s.samples) && now.Sub(s.samples[expired].at) > longest {
+		expired++
+	}
+	s.samples = s.samples[expired:]
+}
+
+// recordFound records a block accepted by the work source, found in the
+// given time since mining on its parent started
+func (s *Stats) recordFound(block *blockchain.Block, timeToFind time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.found = append(s.found, FoundBlock{
+		Index:      block.Index,
+		Hash:       block.Hash,
+		FoundAt:    time.Now(),
+		TimeToFind: timeToFind.Seconds(),
+	})
+	if len(s.found) > maxFoundBlocks {
+		s.found = s.found[len(s.found)-maxFoundBlocks:]
+	}
+
+	s.foundTotal++
+	s.timeToFind += timeToFind
+}
+
+// recordStale records a solved block whose parent was no longer the tip
+func (s *Stats) recordStale() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stale++
+}
+
+// recordRejected records a solved block refused by the work source
+func (s *Stats) recordRejected() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rejected++
+}
+
+// Snapshot returns the statistics. With the chain of the node, found blocks no
+// longer in the chain are counted as orphaned and the network hash rate is
+// estimated from the difficulty and timestamps of the last blocks.
+func (s *Stats) Snapshot(bc *blockchain.Blockchain) StatsSnapshot {
+	s.mu.Lock()
+	now := time.Now()
+	snapshot := StatsSnapshot{
+		HashRates:      make(map[string]float64, len(statsWindows)),
+		Hashes:         s.hashes,
+		BlocksFound:    s.foundTotal,
+		StaleBlocks:    s.stale,
+		RejectedBlocks: s.rejected,
+	}
+
+	// Windows longer than the uptime are averaged over the uptime
+	for _, window := range statsWindows {
+		duration := window.duration
+		if uptime := now.Sub(s.started); uptime < duration {
+			duration = uptime
+		}
+
+		var hashes uint64
+		for _, sample := range s.samples {
+			if now.Sub(sample.at) <= window.duration {
+				hashes += sample.hashes
+			}
+		}
+
+		if duration > 0 {
+			snapshot.HashRates[window.name] = float64(hashes) / duration.Seconds()
+		}
+	}
+
+	if len(s.found) > 0 {
+		last := s.found[len(s.found)-1]
+		snapshot.LastBlock = &last
+		snapshot.AverageTimeToFind = s.timeToFind.Seconds() / float64(s.foundTotal)
+	}
+
+	// The chain is read without holding the lock
+	found := append([]FoundBlock(nil), s.found...)
+	s.mu.Unlock()
+
+	if bc == nil {
+		return snapshot
+	}
+
+	// Blocks found by the miner were in the chain when they were accepted
+	for _, block := range found {
+		if inChain, err := bc.GetBlock(block.Index); err != nil || inChain.Hash != block.Hash {
+			snapshot.OrphanedBlocks++
+		}
+	}
+
+	if rate, err := bc.EstimateNetworkHashRate(networkHashRateBlocks); err == nil {
+		snapshot.NetworkHashRate = rate
+		if rate > 0 {
+			snapshot.NetworkShare = snapshot.HashRates[statsWindows[0].name] / rate
+		}
+	}
+
+	return snapshot
+}
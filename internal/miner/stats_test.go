@@ -0,0 +1,41 @@
+package miner
+
+import (
+	"blockchain-go/internal/blockchain"
+	"testing"
+	"time"
+)
+
+func TestOrphanedBlocks(t *testing.T) {
+	source, bc := newTestWorkSource(t, false)
+	for i := 0; i < 2; i++ {
+		if err := source.SubmitBlock(solveTemplate(t, getTemplate(t, source))); err != nil {
+			t.Fatalf("failed to submit block: %v", err)
+		}
+	}
+
+	inChain, err := bc.GetBlock(1)
+	if err != nil {
+		t.Fatalf("failed to get block: %v", err)
+	}
+
+	// Found blocks replaced by another block of their index, or beyond the
+	// tip after a reorganization to a shorter chain, are orphaned
+	stats := newStats()
+	stats.recordFound(inChain, time.Second)
+	stats.recordFound(&blockchain.Block{BlockHeader: blockchain.BlockHeader{Index: 2, Hash: "replaced"}}, time.Second)
+	stats.recordFound(&blockchain.Block{BlockHeader: blockchain.BlockHeader{Index: 5, Hash: "beyond"}}, time.Second)
+
+	snapshot := stats.Snapshot(bc)
+	if snapshot.BlocksFound != 3 || snapshot.OrphanedBlocks != 2 {
+		t.Fatalf("%d blocks found and %d orphaned, want 3 and 2", snapshot.BlocksFound, snapshot.OrphanedBlocks)
+	}
+	if snapshot.LastBlock == nil || snapshot.LastBlock.Hash != "beyond" {
+		t.Fatalf("last found block %+v, want the latest one", snapshot.LastBlock)
+	}
+
+	// Without a chain nothing is known to be orphaned
+	if snapshot := stats.Snapshot(nil); snapshot.OrphanedBlocks != 0 {
+		t.Fatalf("%d blocks orphaned without a chain", snapshot.OrphanedBlocks)
+	}
+}
@@ -0,0 +1,247 @@
+package miner
+
+import (
+	"blockchain-go/internal/blockchain"
+	"blockchain-go/internal/network"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// ErrNotProducer is returned for templates requested from a node that may not
+// produce blocks on a permissioned chain
+var ErrNotProducer = errors.New("node is not a block producer")
+
+// ErrStaleBlock is returned for solved blocks whose parent is no longer the tip
+var ErrStaleBlock = errors.New("block does not extend the current tip")
+
+// maxIssuedTemplates is the number of templates remembered by a local work
+// source to accept the membership updates they carry
+const maxIssuedTemplates = 64
+
+// BlockTemplate describes the next block to mine. A miner fills the nonce and
+// extra nonce of the block built by Block until its hash, computed with the
+// proof-of-work function named PoW, starts with Target.
+// Pools also set the start of the extra nonce range of the miner and the lower
+// difficulty of shares.
+type BlockTemplate struct {
+	Index               int    `json:"index"`
+	PreviousHash        string `json:"previous_hash"`
+	Timestamp           int64  `json:"timestamp"`
+	Difficulty          int    `json:"difficulty"`
+	NextBlockDifficulty int    `json:"next_block_difficulty"`
+	Data                string `json:"data"`
+	DataHash            string `json:"data_hash"`
+	Producer            string `json:"producer,omitempty"`
+	Target              string `json:"target"`
+	PoW                 string `json:"pow,omitempty"`
+	ExtraNonce          uint64 `json:"extra_nonce,omitempty"`
+	ShareDifficulty     int    `json:"share_difficulty,omitempty"`
+}
+
+// NewTemplateFromBlock describes an unsolved block as a template
+func NewTemplateFromBlock(block *blockchain.Block) *BlockTemplate {
+	return &BlockTemplate{
+		Index:               block.Index,
+		PreviousHash:        block.PreviousHash,
+		Timestamp:           block.Timestamp,
+		Difficulty:          block.Difficulty,
+		NextBlockDifficulty: block.NextBlockDifficulty,
+		Data:                block.Data,
+		DataHash:            block.DataHash,
+		Producer:            block.Producer,
+		Target:              strings.Repeat("0", block.Difficulty),
+	}
+}
+
+// Block returns the unsolved block described by the template
+func (t *BlockTemplate) Block() *blockchain.Block {
+	return &blockchain.Block{
+		BlockHeader: blockchain.BlockHeader{
+			Index:               t.Index,
+			Timestamp:           t.Timestamp,
+			Difficulty:          t.Difficulty,
+			NextBlockDifficulty: t.NextBlockDifficulty,
+			DataHash:            t.DataHash,
+			PreviousHash:        t.PreviousHash,
+			ExtraNonce:          t.ExtraNonce,
+			Producer:            t.Producer,
+		},
+		Data: t.Data,
+	}
+}
+
+// ProofOfWork returns the proof-of-work function of the template, the default
+// one for templates that do not name any
+func (t *BlockTemplate) ProofOfWork() (blockchain.PoW, error) {
+	return blockchain.PoWByName(t.PoW)
+}
+
+// WorkSource hands out block templates and accepts the solved blocks. The
+// built-in miner and external miners use the same interface, either in
+// process or through the admin API.
+type WorkSource interface {
+	// GetBlockTemplate returns a template of the next block on top of the tip
+	GetBlockTemplate() (*BlockTemplate, error)
+
+	// SubmitBlock adds a solved block to the chain and announces it
+	SubmitBlock(block *blockchain.Block) error
+}
+
+// ShareSubmitter is implemented by work sources accepting shares, solutions
+// meeting the share difficulty of the template but not its difficulty
+type ShareSubmitter interface {
+	SubmitShare(block *blockchain.Block) error
+}
+
+// TipNotifier is implemented by work sources that announce tip changes, so
+// that miners abandon their template as soon as it becomes stale
+type TipNotifier interface {
+	SubscribeTip() (<-chan *blockchain.Block, func())
+}
+
+// LocalWorkSource is the work source of a node, building templates from its
+// chain and submitting solved blocks to it and its peers
+type LocalWorkSource struct {
+	networkManager *network.Manager
+
+	mu     sync.Mutex
+	issued []string // keys of the templates carrying membership updates, oldest first
+}
+
+// NewLocalWorkSource creates the work source of the node of the given network manager
+func NewLocalWorkSource(nm *network.Manager) *LocalWorkSource {
+	return &LocalWorkSource{networkManager: nm}
+}
+
+// GetBlockTemplate returns a template of the next block on top of the tip
+func (s *LocalWorkSource) GetBlockTemplate() (*BlockTemplate, error) {
+	// The tip, difficulty and membership of the template are read at once
+	snapshot, err := s.networkManager.GetBlockchain().GetTipSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	// Only producers may mine on permissioned chains
+	producer := s.producer()
+	if snapshot.Membership != nil && !snapshot.Membership.IsProducer(producer) {
+		return nil, ErrNotProducer
+	}
+
+	block := NewBlockFromTip(snapshot, blockData(snapshot.PendingUpdates))
+	block.Producer = producer
+	if isMembershipData(block.Data) {
+		s.recordIssued(block)
+	}
+
+	template := NewTemplateFromBlock(block)
+	template.PoW = s.networkManager.GetBlockchain().GetPoW().Name()
+	return template, nil
+}
+
+// SubmitBlock adds a solved block to the chain and announces it. Blocks of
+// permissioned chains are signed with the node identity, which must be their
+// producer. Membership updates are only signed in blocks of templates issued
+// by this work source, so that submitters cannot have the node sign updates
+// of their own.
+func (s *LocalWorkSource) SubmitBlock(block *blockchain.Block) error {
+	bc := s.networkManager.GetBlockchain()
+
+	if block.Producer != "" || bc.IsPermissioned() {
+		if block.Producer != s.producer() {
+			return fmt.Errorf("block producer is not this node")
+		}
+		if block.DataHash != blockchain.ComputeDataHash(block.Data) {
+			return fmt.Errorf("block data does not match its data hash")
+		}
+		if isMembershipData(block.Data) && !s.wasIssued(block) {
+			return fmt.Errorf("block membership updates were not issued by this node")
+		}
+		block.Sign(s.networkManager.GetIdentity().PrivateKey)
+	}
+
+	if latestBlock, err := bc.GetLatestBlock(); err == nil && block.PreviousHash != latestBlock.Hash {
+		return ErrStaleBlock
+	}
+
+	if err := bc.AddBlock(block); err != nil {
+		return err
+	}
+
+	// Announce found block
+	if err := s.networkManager.AnnounceBlock(block); err != nil {
+		log.Printf("Failed to announce block #%d: %v", block.Index, err)
+	} else {
+		log.Printf("Announced found block #%d", block.Index)
+	}
+
+	return nil
+}
+
+// SubscribeTip notifies tip changes of the chain of the node
+func (s *LocalWorkSource) SubscribeTip() (<-chan *blockchain.Block, func()) {
+	return s.networkManager.GetBlockchain().SubscribeTip()
+}
+
+// templateKey identifies the template a block was built from
+func templateKey(block *blockchain.Block) string {
+	return block.PreviousHash + ":" + block.DataHash
+}
+
+// recordIssued remembers a template carrying membership updates, forgetting
+// the oldest ones beyond maxIssuedTemplates
+func (s *LocalWorkSource) recordIssued(block *blockchain.Block) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.issued) >= maxIssuedTemplates {
+		s.issued = s.issued[1:]
+	}
+	s.issued = append(s.issued, templateKey(block))
+}
+
+// wasIssued checks if a block was built from a template issued by this work source
+func (s *LocalWorkSource) wasIssued(block *blockchain.Block) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := templateKey(block)
+	for _, issued := range s.issued {
+		if issued == key {
+			return true
+		}
+	}
+	return false
+}
+
+// isMembershipData checks if block data carries membership updates, malformed
+// ones included
+func isMembershipData(data string) bool {
+	updates, err := blockchain.ParseMembershipData(data)
+	return err != nil || len(updates) > 0
+}
+
+// producer returns the public key committed in mined blocks, only set on permissioned chains
+func (s *LocalWorkSource) producer() string {
+	if !s.networkManager.GetBlockchain().IsPermissioned() {
+		return ""
+	}
+	return blockchain.EncodePublicKey(s.networkManager.GetIdentity().PublicKey)
+}
+
+// blockData returns the data of the next block, recording the pending
+// membership updates on permissioned chains
+func blockData(updates []blockchain.MembershipUpdate) string {
+	if len(updates) == 0 {
+		return "data"
+	}
+
+	data, err := blockchain.NewMembershipData(updates)
+	if err != nil {
+		log.Printf("Failed to encode membership updates: %v", err)
+		return "data"
+	}
+	return data
+}
@@ -0,0 +1,185 @@
+package miner
+
+import (
+	"blockchain-go/internal/blockchain"
+	"blockchain-go/internal/config"
+	"blockchain-go/internal/network"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Every template and block is logged
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newTestWorkSource returns the work source of a node that is not listening,
+// with a regtest chain holding its genesis block. On permissioned chains, the
+// node is the only producer.
+func newTestWorkSource(t *testing.T, permissioned bool) (*LocalWorkSource, *blockchain.Blockchain) {
+	t.Helper()
+
+	cfg := config.Default().Network
+	cfg.BanFile = ""
+	cfg.IdentityFile = ""
+
+	bc := blockchain.New(config.Default().Blockchain.DifficultyCalculationBlocks, 1)
+	bc.SetFixedDifficulty(blockchain.RegtestDifficulty)
+	nm := network.NewManagerWithTransport(cfg, bc, network.NewMemoryNetwork().Transport("10.0.0.1"))
+
+	if permissioned {
+		producer := blockchain.EncodePublicKey(nm.GetIdentity().PublicKey)
+		membership, err := blockchain.NewMembership(nil, []string{producer})
+		if err != nil {
+			t.Fatalf("failed to create membership: %v", err)
+		}
+		bc.SetMembership(membership)
+	}
+
+	bc.CreateGenesisBlock()
+	return NewLocalWorkSource(nm), bc
+}
+
+// solveTemplate mines the block of a template
+func solveTemplate(t *testing.T, template *BlockTemplate) *blockchain.Block {
+	t.Helper()
+
+	pow, err := template.ProofOfWork()
+	if err != nil {
+		t.Fatalf("template has no proof-of-work: %v", err)
+	}
+
+	block := template.Block()
+	block.Mine(pow)
+	return block
+}
+
+// getTemplate returns a template of the work source
+func getTemplate(t *testing.T, source WorkSource) *BlockTemplate {
+	t.Helper()
+
+	template, err := source.GetBlockTemplate()
+	if err != nil {
+		t.Fatalf("failed to get block template: %v", err)
+	}
+	return template
+}
+
+// newPublicKey returns the encoded public key of a new node
+func newPublicKey(t *testing.T) string {
+	t.Helper()
+
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return blockchain.EncodePublicKey(publicKey)
+}
+
+func TestLocalWorkSourceSubmit(t *testing.T) {
+	source, bc := newTestWorkSource(t, false)
+
+	for i := 1; i <= 3; i++ {
+		template := getTemplate(t, source)
+		if template.Index != i || template.Target != strings.Repeat("0", template.Difficulty) {
+			t.Fatalf("template %+v does not describe block #%d", template, i)
+		}
+
+		if err := source.SubmitBlock(solveTemplate(t, template)); err != nil {
+			t.Fatalf("failed to submit block #%d: %v", i, err)
+		}
+	}
+
+	if length := bc.GetChainLength(); length != 4 {
+		t.Fatalf("chain of %d blocks, want 4", length)
+	}
+}
+
+func TestLocalWorkSourceStaleBlock(t *testing.T) {
+	source, bc := newTestWorkSource(t, false)
+
+	stale := getTemplate(t, source)
+	if err := source.SubmitBlock(solveTemplate(t, getTemplate(t, source))); err != nil {
+		t.Fatalf("failed to submit block: %v", err)
+	}
+
+	if err := source.SubmitBlock(solveTemplate(t, stale)); !errors.Is(err, ErrStaleBlock) {
+		t.Fatalf("submitting a block of a previous tip returned %v, want %v", err, ErrStaleBlock)
+	}
+	if length := bc.GetChainLength(); length != 2 {
+		t.Fatalf("chain of %d blocks, want 2", length)
+	}
+}
+
+func TestLocalWorkSourceNotProducer(t *testing.T) {
+	source, bc := newTestWorkSource(t, false)
+
+	membership, err := blockchain.NewMembership(nil, []string{newPublicKey(t)})
+	if err != nil {
+		t.Fatalf("failed to create membership: %v", err)
+	}
+	bc.SetMembership(membership)
+
+	if _, err := source.GetBlockTemplate(); !errors.Is(err, ErrNotProducer) {
+		t.Fatalf("template of a node that is not a producer returned %v, want %v", err, ErrNotProducer)
+	}
+}
+
+func TestLocalWorkSourceMembershipUpdates(t *testing.T) {
+	source, bc := newTestWorkSource(t, true)
+
+	member := newPublicKey(t)
+	if err := bc.ProposeMembershipUpdate(blockchain.MembershipUpdate{
+		Action: blockchain.MembershipAdd, Role: blockchain.RoleMember, PublicKey: member,
+	}); err != nil {
+		t.Fatalf("failed to propose update: %v", err)
+	}
+
+	template := getTemplate(t, source)
+	if updates, err := blockchain.ParseMembershipData(template.Data); err != nil || len(updates) != 1 {
+		t.Fatalf("template data %q does not carry the proposed update", template.Data)
+	}
+
+	// Updates that the node did not propose are never signed
+	intruder := newPublicKey(t)
+	forgedData, err := blockchain.NewMembershipData([]blockchain.MembershipUpdate{
+		{Action: blockchain.MembershipAdd, Role: blockchain.RoleProducer, PublicKey: intruder},
+	})
+	if err != nil {
+		t.Fatalf("failed to encode forged update: %v", err)
+	}
+
+	forged := *template
+	forged.Data = forgedData
+	forged.DataHash = blockchain.ComputeDataHash(forgedData)
+	forgedBlock := solveTemplate(t, &forged)
+	if err := source.SubmitBlock(forgedBlock); err == nil {
+		t.Fatal("block with membership updates of another template accepted")
+	}
+	if forgedBlock.Signature != "" {
+		t.Fatal("block with membership updates of another template signed")
+	}
+
+	// Neither is data swapped under the data hash of an issued template
+	swapped := solveTemplate(t, template)
+	swapped.Data = forgedData
+	if err := source.SubmitBlock(swapped); err == nil || swapped.Signature != "" {
+		t.Fatal("block with data not matching its data hash signed")
+	}
+
+	if err := source.SubmitBlock(solveTemplate(t, template)); err != nil {
+		t.Fatalf("failed to submit block of an issued template: %v", err)
+	}
+
+	membership := bc.GetMembership()
+	if !membership.IsMember(member) || membership.IsProducer(intruder) {
+		t.Fatal("membership does not reflect the proposed update only")
+	}
+}
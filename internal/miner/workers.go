@@ -0,0 +1,176 @@
+package miner
+
+import (
+	"blockchain-go/internal/blockchain"
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// dutyPeriod is the period over which workers alternate hashing and sleeping
+// to honor the duty cycle
+const dutyPeriod = 100 * time.Millisecond
+
+// maxWorkers is the maximum number of mining goroutines set at runtime
+const maxWorkers = 1024
+
+// HashRates holds the hash rates measured over the last reporting interval
+type HashRates struct {
+	Workers []float64 `json:"workers"`
+	Total   float64   `json:"total"`
+}
+
+// String returns the per-worker hash rates
+func (r HashRates) String() string {
+	rates := make([]string, len(r.Workers))
+	for worker, rate := range r.Workers {
+		rates[worker] = fmt.Sprintf("%.2f", rate)
+	}
+	return strings.Join(rates, ", ")
+}
+
+// workerPool searches the nonce space of block templates with several goroutines
+type workerPool struct {
+	maxNonce  int
+	hashes    []atomic.Uint64
+	dutyCycle atomic.Int64
+
+	mu          sync.Mutex
+	rates       HashRates
+	lastMeasure time.Time
+}
+
+// newWorkerPool creates a pool of the given number of workers, one per CPU if
+// 0, hashing the given percentage of the time
+func newWorkerPool(workers, maxNonce, dutyCycle int) *workerPool {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if maxNonce < workers {
+		maxNonce = workers
+	}
+
+	wp := &workerPool{
+		maxNonce:    maxNonce,
+		hashes:      make([]atomic.Uint64, workers),
+		rates:       HashRates{Workers: make([]float64, workers)},
+		lastMeasure: time.Now(),
+	}
+	wp.setDutyCycle(dutyCycle)
+	return wp
+}
+
+// setDutyCycle sets the percentage of the time the workers hash, between 1 and 100
+func (wp *workerPool) setDutyCycle(dutyCycle int) {
+	if dutyCycle <= 0 || dutyCycle > 100 {
+		dutyCycle = 100
+	}
+	wp.dutyCycle.Store(int64(dutyCycle))
+}
+
+// getDutyCycle returns the percentage of the time the workers hash
+func (wp *workerPool) getDutyCycle() int {
+	return int(wp.dutyCycle.Load())
+}
+
+// size returns the number of workers
+func (wp *workerPool) size() int {
+	return len(wp.hashes)
+}
+
+// solve mines the template with the given proof-of-work function until a
+// worker finds a valid hash or the context is done, returning nil in the
+// latter case. Each worker hashes its own slice of the nonce space in order,
+// rolling its own extra nonce, and all of them stop as soon as one finds a
+// solution. Extra nonces start at the extra nonce of the template. When share
+// is set, it is called for every hash meeting the share difficulty.
+func (wp *workerPool) solve(ctx context.Context, pow blockchain.PoW, template *blockchain.Block, shareDifficulty int, share func(*blockchain.Block)) *blockchain.Block {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	solutions := make(chan *blockchain.Block, wp.size())
+	partition := wp.maxNonce / wp.size()
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < wp.size(); worker++ {
+		// The last worker also covers the remainder of the nonce space
+		start, end := worker*partition, (worker+1)*partition
+		if worker == wp.size()-1 {
+			end = wp.maxNonce
+		}
+
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+
+			// Sleep between bursts of hashes below a full duty cycle
+			workStart := time.Now()
+			stop := func() bool {
+				if duty := time.Duration(wp.dutyCycle.Load()); duty < 100 && time.Since(workStart) >= dutyPeriod*duty/100 {
+					select {
+					case <-time.After(dutyPeriod * (100 - duty) / 100):
+					case <-ctx.Done():
+					}
+					workStart = time.Now()
+				}
+				return ctx.Err() != nil
+			}
+
+			block := *template
+			block.ExtraNonce += uint64(worker)
+			found, hashes := block.MineShares(pow, start, end, uint64(wp.size()), shareDifficulty, share, stop)
+			wp.hashes[worker].Add(hashes)
+
+			if found {
+				solutions <- &block
+				cancel()
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	select {
+	case block := <-solutions:
+		return block
+	default:
+		return nil
+	}
+}
+
+// measure computes the hash rates since the last measure and resets the
+// counters, also returning the number of hashes computed in the meantime
+func (wp *workerPool) measure() (HashRates, uint64) {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+
+	elapsed := time.Since(wp.lastMeasure).Seconds()
+	wp.lastMeasure = time.Now()
+
+	var total uint64
+	rates := HashRates{Workers: make([]float64, wp.size())}
+	for worker := range wp.hashes {
+		hashes := wp.hashes[worker].Swap(0)
+		total += hashes
+		if elapsed > 0 {
+			rates.Workers[worker] = float64(hashes) / elapsed
+		}
+		rates.Total += rates.Workers[worker]
+	}
+
+	wp.rates = rates
+	return rates, total
+}
+
+// lastRates returns the hash rates of the last measure
+func (wp *workerPool) lastRates() HashRates {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+
+	rates := wp.rates
+	rates.Workers = append([]float64(nil), wp.rates.Workers...)
+	return rates
+}
@@ -0,0 +1,138 @@
+package miner
+
+import (
+	"blockchain-go/internal/blockchain"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingPoW records the nonce and extra nonce of every header hashed by
+// the workers, never producing a valid hash, and cancels the mining after a
+// number of hashes
+type recordingPoW struct {
+	mu     sync.Mutex
+	hashed []headerNonces
+	limit  int
+	cancel context.CancelFunc
+}
+
+// headerNonces are the nonces of a hashed header
+type headerNonces struct {
+	nonce      int
+	extraNonce uint64
+}
+
+func (p *recordingPoW) Name() string {
+	return "recording"
+}
+
+// Hash parses the nonces of the headers of index 7 built on "p", serialized
+// as the index, the nonce, the previous hash, the other fields and the extra nonce
+func (p *recordingPoW) Hash(data []byte) string {
+	serialized := string(data)
+	nonce, _ := strconv.Atoi(serialized[1:strings.Index(serialized, "p")])
+	extraNonce, _ := strconv.ParseUint(serialized[strings.LastIndex(serialized, ":")+1:], 10, 64)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.hashed = append(p.hashed, headerNonces{nonce: nonce, extraNonce: extraNonce})
+	if len(p.hashed) >= p.limit {
+		p.cancel()
+	}
+	return "invalid"
+}
+
+func TestWorkerPoolPartitionsNonces(t *testing.T) {
+	const (
+		workers    = 3
+		maxNonce   = 31
+		extraNonce = 10
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pow := &recordingPoW{limit: 2000, cancel: cancel}
+
+	template := blockchain.NewBlock(7, 64, 64, "data", "p")
+	template.ExtraNonce = extraNonce
+
+	wp := newWorkerPool(workers, maxNonce, 100)
+	if block := wp.solve(ctx, pow, template, 0, nil); block != nil {
+		t.Fatal("found a block with a proof-of-work producing no valid hash")
+	}
+
+	_, hashes := wp.measure()
+	if hashes != uint64(len(pow.hashed)) {
+		t.Fatalf("counted %d hashes, computed %d", hashes, len(pow.hashed))
+	}
+
+	// Each worker rolls its own extra nonces over its own slice of nonces
+	partition := maxNonce / workers
+	seen := make(map[headerNonces]bool, len(pow.hashed))
+	for _, hashed := range pow.hashed {
+		worker := int((hashed.extraNonce - extraNonce) % workers)
+		start, end := worker*partition, (worker+1)*partition
+		if worker == workers-1 {
+			end = maxNonce
+		}
+
+		if hashed.extraNonce < extraNonce || hashed.nonce < start || hashed.nonce >= end {
+			t.Fatalf("worker %d hashed nonce %d with extra nonce %d, outside [%d, %d)",
+				worker, hashed.nonce, hashed.extraNonce, start, end)
+		}
+
+		if seen[hashed] {
+			t.Fatalf("nonce %d with extra nonce %d hashed twice", hashed.nonce, hashed.extraNonce)
+		}
+		seen[hashed] = true
+	}
+}
+
+func TestWorkerPoolSolves(t *testing.T) {
+	template := blockchain.NewBlock(1, 1, 1, "data", "previous")
+
+	wp := newWorkerPool(4, blockchain.DefaultMaxNonce, 100)
+	block := wp.solve(context.Background(), blockchain.DefaultPoW, template, 0, nil)
+	if block == nil {
+		t.Fatal("no block found at difficulty 1")
+	}
+
+	if err := block.IsValid(blockchain.DefaultPoW); err != nil {
+		t.Fatalf("found an invalid block: %v", err)
+	}
+	if template.Hash != "" || template.Nonce != 0 {
+		t.Fatal("the workers modified the template")
+	}
+}
+
+func TestWorkerPoolCancellation(t *testing.T) {
+	for _, dutyCycle := range []int{100, 10} {
+		t.Run(fmt.Sprintf("duty cycle %d", dutyCycle), func(t *testing.T) {
+			template := blockchain.NewBlock(1, 64, 64, "data", "previous")
+			wp := newWorkerPool(4, blockchain.DefaultMaxNonce, dutyCycle)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(100*time.Millisecond, cancel)
+
+			solved := make(chan *blockchain.Block, 1)
+			go func() {
+				solved <- wp.solve(ctx, blockchain.DefaultPoW, template, 0, nil)
+			}()
+
+			select {
+			case block := <-solved:
+				if block != nil {
+					t.Fatal("found a block at difficulty 64")
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("workers still mining after cancellation")
+			}
+		})
+	}
+}
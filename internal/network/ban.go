@@ -0,0 +1,279 @@
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Misbehavior scores added for protocol violations
+const (
+	MisbehaviorMalformedPacket = 20
+	MisbehaviorUnknownPacket   = 10
+	MisbehaviorBogusFoundBlock = 20
+	MisbehaviorBogusInventory  = 20
+	MisbehaviorInvalidBlock    = 100
+	MisbehaviorImpersonation   = 100
+	MisbehaviorRateLimited     = 1
+)
+
+// scoreDecayInterval is the time after which one point of misbehavior score
+// is forgiven, so that the occasional races of honest peers never add up to a ban
+const scoreDecayInterval = time.Minute
+
+// maxScoredAddresses is the number of scored addresses above which the
+// addresses whose score decayed to zero are dropped
+const maxScoredAddresses = 1024
+
+// Ban represents a time-limited ban of a peer address
+type Ban struct {
+	Address   string    `json:"address"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// IsExpired checks if the ban has expired
+func (b *Ban) IsExpired() bool {
+	return time.Now().After(b.ExpiresAt)
+}
+
+// misbehaviorScore is the score of an address, decayed until updated
+type misbehaviorScore struct {
+	value   int
+	updated time.Time
+}
+
+// BanManager tracks misbehavior scores and bans of peer addresses
+type BanManager struct {
+	mu        sync.Mutex
+	path      string
+	threshold int
+	duration  time.Duration
+	scores    map[string]*misbehaviorScore
+	bans      map[string]*Ban
+}
+
+// NewBanManager creates a new ban manager and loads persisted bans from path
+func NewBanManager(path string, threshold int, duration time.Duration) (*BanManager, error) {
+	bm := &BanManager{
+		path:      path,
+		threshold: threshold,
+		duration:  duration,
+		scores:    make(map[string]*misbehaviorScore),
+		bans:      make(map[string]*Ban),
+	}
+
+	if err := bm.load(); err != nil {
+		return bm, err
+	}
+
+	return bm, nil
+}
+
+// Misbehaving adds a misbehavior score to an address and bans it when the
+// threshold is reached. It returns true if the address got banned. Scores
+// decay by one point every scoreDecayInterval.
+func (bm *BanManager) Misbehaving(address string, score int, reason string) bool {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	now := time.Now()
+	if len(bm.scores) >= maxScoredAddresses {
+		bm.pruneScores(now)
+	}
+
+	value := bm.decayedScore(address, now) + score
+	if bm.threshold <= 0 || value < bm.threshold {
+		if existing, exists := bm.scores[address]; exists {
+			existing.value = value
+		} else {
+			bm.scores[address] = &misbehaviorScore{value: value, updated: now}
+		}
+		return false
+	}
+
+	delete(bm.scores, address)
+	bm.banInternal(address, bm.duration, reason)
+	return true
+}
+
+// GetScore returns the current misbehavior score of an address
+func (bm *BanManager) GetScore(address string) int {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	return bm.decayedScore(address, time.Now())
+}
+
+// decayedScore returns the score of an address at the given time, dropping
+// scores decayed to zero (internal use, no locking)
+func (bm *BanManager) decayedScore(address string, now time.Time) int {
+	score, exists := bm.scores[address]
+	if !exists {
+		return 0
+	}
+
+	decay := int(now.Sub(score.updated) / scoreDecayInterval)
+	if decay >= score.value {
+		delete(bm.scores, address)
+		return 0
+	}
+
+	// Keep the remainder of the current interval
+	score.value -= decay
+	score.updated = score.updated.Add(time.Duration(decay) * scoreDecayInterval)
+	return score.value
+}
+
+// pruneScores drops the scores decayed to zero (internal use, no locking)
+func (bm *BanManager) pruneScores(now time.Time) {
+	for address := range bm.scores {
+		bm.decayedScore(address, now)
+	}
+}
+
+// Ban bans an address for the given duration, or the default duration if zero
+func (bm *BanManager) Ban(address string, duration time.Duration, reason string) error {
+	if address == "" {
+		return fmt.Errorf("cannot ban an empty address")
+	}
+
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	if duration <= 0 {
+		duration = bm.duration
+	}
+
+	return bm.banInternal(address, duration, reason)
+}
+
+// banInternal bans an address and persists the ban list (internal use, no locking)
+func (bm *BanManager) banInternal(address string, duration time.Duration, reason string) error {
+	now := time.Now()
+	bm.bans[address] = &Ban{
+		Address:   address,
+		Reason:    reason,
+		CreatedAt: now,
+		ExpiresAt: now.Add(duration),
+	}
+
+	return bm.save()
+}
+
+// Unban lifts the ban of an address
+func (bm *BanManager) Unban(address string) error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	if _, exists := bm.bans[address]; !exists {
+		return fmt.Errorf("address %s is not banned", address)
+	}
+
+	delete(bm.bans, address)
+	return bm.save()
+}
+
+// IsBanned checks if an address is currently banned. Expired bans are only
+// dropped from memory; the ban file is rewritten by the next Save.
+func (bm *BanManager) IsBanned(address string) bool {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	ban, exists := bm.bans[address]
+	if !exists {
+		return false
+	}
+
+	if ban.IsExpired() {
+		delete(bm.bans, address)
+		return false
+	}
+
+	return true
+}
+
+// List returns all active bans
+func (bm *BanManager) List() []Ban {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	bans := make([]Ban, 0, len(bm.bans))
+	for address, ban := range bm.bans {
+		if ban.IsExpired() {
+			delete(bm.bans, address)
+			continue
+		}
+		bans = append(bans, *ban)
+	}
+
+	return bans
+}
+
+// Save persists the ban list to disk
+func (bm *BanManager) Save() error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	return bm.save()
+}
+
+// save writes the ban list to disk (internal use, no locking)
+func (bm *BanManager) save() error {
+	if bm.path == "" {
+		return nil
+	}
+
+	bans := make([]*Ban, 0, len(bm.bans))
+	for _, ban := range bm.bans {
+		bans = append(bans, ban)
+	}
+
+	data, err := json.MarshalIndent(bans, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal bans: %w", err)
+	}
+
+	// Write to a temporary file first so that an interrupted write never
+	// leaves a truncated ban list behind
+	tmpPath := bm.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write ban file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, bm.path); err != nil {
+		return fmt.Errorf("failed to replace ban file: %w", err)
+	}
+
+	return nil
+}
+
+// load reads the ban list from disk, dropping expired bans
+func (bm *BanManager) load() error {
+	if bm.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(bm.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read ban file: %w", err)
+	}
+
+	var bans []*Ban
+	if err := json.Unmarshal(data, &bans); err != nil {
+		return fmt.Errorf("failed to unmarshal bans: %w", err)
+	}
+
+	for _, ban := range bans {
+		if !ban.IsExpired() {
+			bm.bans[ban.Address] = ban
+		}
+	}
+
+	return nil
+}
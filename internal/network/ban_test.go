@@ -0,0 +1,145 @@
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBanPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.json")
+
+	bm, err := NewBanManager(path, 100, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create ban manager: %v", err)
+	}
+
+	if err := bm.Ban("10.0.0.1", 0, "manual"); err != nil {
+		t.Fatalf("failed to ban: %v", err)
+	}
+	if err := bm.Ban("10.0.0.2", time.Hour, "manual"); err != nil {
+		t.Fatalf("failed to ban: %v", err)
+	}
+	if err := bm.Unban("10.0.0.2"); err != nil {
+		t.Fatalf("failed to unban: %v", err)
+	}
+
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temporary ban file left behind: %v", err)
+	}
+
+	reloaded, err := NewBanManager(path, 100, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to reload bans: %v", err)
+	}
+
+	if !reloaded.IsBanned("10.0.0.1") {
+		t.Fatal("ban was not persisted")
+	}
+	if reloaded.IsBanned("10.0.0.2") {
+		t.Fatal("lifted ban was persisted")
+	}
+
+	bans := reloaded.List()
+	if len(bans) != 1 || bans[0].Reason != "manual" {
+		t.Fatalf("reloaded bans %+v, want the manual ban of 10.0.0.1", bans)
+	}
+}
+
+func TestBanExpiry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.json")
+
+	bm, err := NewBanManager(path, 100, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create ban manager: %v", err)
+	}
+
+	if err := bm.Ban("10.0.0.1", time.Hour, "active"); err != nil {
+		t.Fatalf("failed to ban: %v", err)
+	}
+	if err := bm.Ban("10.0.0.2", time.Hour, "expired"); err != nil {
+		t.Fatalf("failed to ban: %v", err)
+	}
+
+	// Expire the second ban and persist it expired
+	bm.mu.Lock()
+	bm.bans["10.0.0.2"].ExpiresAt = time.Now().Add(-time.Second)
+	bm.mu.Unlock()
+	if err := bm.Save(); err != nil {
+		t.Fatalf("failed to save bans: %v", err)
+	}
+
+	if bm.IsBanned("10.0.0.2") {
+		t.Fatal("expired ban still active")
+	}
+	if len(bm.List()) != 1 {
+		t.Fatalf("listed %d bans, want 1", len(bm.List()))
+	}
+
+	// Expired bans are dropped when loading
+	reloaded, err := NewBanManager(path, 100, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to reload bans: %v", err)
+	}
+	if _, exists := reloaded.bans["10.0.0.2"]; exists {
+		t.Fatal("expired ban was loaded")
+	}
+	if !reloaded.IsBanned("10.0.0.1") {
+		t.Fatal("active ban was not loaded")
+	}
+}
+
+func TestMisbehaviorThreshold(t *testing.T) {
+	bm, err := NewBanManager("", 100, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create ban manager: %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if bm.Misbehaving("10.0.0.1", MisbehaviorBogusInventory, "bogus inventory") {
+			t.Fatalf("banned after %d points", (i+1)*MisbehaviorBogusInventory)
+		}
+	}
+
+	if !bm.Misbehaving("10.0.0.1", MisbehaviorBogusInventory, "bogus inventory") {
+		t.Fatal("not banned at the threshold")
+	}
+	if !bm.IsBanned("10.0.0.1") || bm.GetScore("10.0.0.1") != 0 {
+		t.Fatal("ban did not replace the score")
+	}
+}
+
+func TestMisbehaviorDecay(t *testing.T) {
+	bm, err := NewBanManager("", 100, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create ban manager: %v", err)
+	}
+
+	bm.Misbehaving("10.0.0.1", 90, "misbehaving")
+
+	// Age the score by half a decay interval more than 30 intervals
+	bm.mu.Lock()
+	bm.scores["10.0.0.1"].updated = time.Now().Add(-30*scoreDecayInterval - scoreDecayInterval/2)
+	bm.mu.Unlock()
+
+	if score := bm.GetScore("10.0.0.1"); score != 60 {
+		t.Fatalf("score %d after decay, want 60", score)
+	}
+
+	// A race of an honest peer long after no longer adds up to a ban
+	if bm.Misbehaving("10.0.0.1", MisbehaviorBogusInventory, "bogus inventory") {
+		t.Fatal("banned after the score decayed")
+	}
+
+	bm.mu.Lock()
+	bm.scores["10.0.0.1"].updated = time.Now().Add(-100 * scoreDecayInterval)
+	bm.mu.Unlock()
+
+	if score := bm.GetScore("10.0.0.1"); score != 0 {
+		t.Fatalf("score %d after full decay, want 0", score)
+	}
+	if _, exists := bm.scores["10.0.0.1"]; exists {
+		t.Fatal("decayed score was kept")
+	}
+}
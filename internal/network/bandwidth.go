@@ -0,0 +1,142 @@
+package network
+
+import (
+	"sync"
+	"time"
+)
+
+// unknownCommand is the command counting the traffic of packets with names
+// outside the protocol, so that peers cannot grow the counters at will
+const unknownCommand = "UNKNOWN"
+
+// Traffic holds the traffic counters of a peer or a command
+type Traffic struct {
+	BytesIn     uint64 `json:"bytes_in"`
+	BytesOut    uint64 `json:"bytes_out"`
+	MessagesIn  uint64 `json:"messages_in"`
+	MessagesOut uint64 `json:"messages_out"`
+}
+
+// BandwidthStats holds the traffic counters of the node
+type BandwidthStats struct {
+	Total    Traffic            `json:"total"`
+	Peers    map[string]Traffic `json:"peers"`
+	Commands map[string]Traffic `json:"commands"`
+}
+
+// BandwidthMeter counts the bytes exchanged per peer and per command, and caps
+// the global upload rate
+type BandwidthMeter struct {
+	mu       sync.Mutex
+	total    Traffic
+	peers    map[string]*Traffic
+	commands map[string]*Traffic
+	upload   *tokenBucket
+}
+
+// NewBandwidthMeter creates a bandwidth meter with an upload cap in bytes per
+// second, zero or less meaning unlimited
+func NewBandwidthMeter(maxUploadRate int) *BandwidthMeter {
+	bm := &BandwidthMeter{
+		peers:    make(map[string]*Traffic),
+		commands: make(map[string]*Traffic),
+	}
+
+	// Allow bursts of one second worth of upload
+	if maxUploadRate > 0 {
+		bm.upload = newTokenBucket(float64(maxUploadRate), maxUploadRate)
+	}
+
+	return bm
+}
+
+// RecordIn records bytes received from a peer for a command. Traffic of an
+// empty peer only counts in the total and command counters.
+func (bm *BandwidthMeter) RecordIn(peer string, command PacketName, n int) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	for _, traffic := range bm.counters(peer, command) {
+		traffic.BytesIn += uint64(n)
+		traffic.MessagesIn++
+	}
+}
+
+// RecordOut records bytes sent to a peer for a command. Traffic of an empty
+// peer only counts in the total and command counters.
+func (bm *BandwidthMeter) RecordOut(peer string, command PacketName, n int) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	for _, traffic := range bm.counters(peer, command) {
+		traffic.BytesOut += uint64(n)
+		traffic.MessagesOut++
+	}
+}
+
+// Forget drops the counters of a peer that is gone. Its traffic remains in
+// the total and command counters.
+func (bm *BandwidthMeter) Forget(peer string) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	delete(bm.peers, peer)
+}
+
+// WaitUpload blocks until n bytes may be uploaded under the upload cap
+func (bm *BandwidthMeter) WaitUpload(n int) {
+	if bm.upload == nil || n == 0 {
+		return
+	}
+
+	bm.mu.Lock()
+	wait := bm.upload.reserve(float64(n))
+	bm.mu.Unlock()
+
+	time.Sleep(wait)
+}
+
+// Stats returns a snapshot of the traffic counters
+func (bm *BandwidthMeter) Stats() BandwidthStats {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	stats := BandwidthStats{
+		Total:    bm.total,
+		Peers:    make(map[string]Traffic, len(bm.peers)),
+		Commands: make(map[string]Traffic, len(bm.commands)),
+	}
+
+	for peer, traffic := range bm.peers {
+		stats.Peers[peer] = *traffic
+	}
+	for command, traffic := range bm.commands {
+		stats.Commands[command] = *traffic
+	}
+	return stats
+}
+
+// counters returns the counters updated for a peer and a command (internal use, no locking)
+func (bm *BandwidthMeter) counters(peer string, command PacketName) []*Traffic {
+	name := string(command)
+	if !command.isKnown() {
+		name = unknownCommand
+	}
+
+	commandTraffic, exists := bm.commands[name]
+	if !exists {
+		commandTraffic = &Traffic{}
+		bm.commands[name] = commandTraffic
+	}
+
+	if peer == "" {
+		return []*Traffic{&bm.total, commandTraffic}
+	}
+
+	peerTraffic, exists := bm.peers[peer]
+	if !exists {
+		peerTraffic = &Traffic{}
+		bm.peers[peer] = peerTraffic
+	}
+
+	return []*Traffic{&bm.total, commandTraffic, peerTraffic}
+}
@@ -0,0 +1,391 @@
+package network
+
+import (
+	"blockchain-go/internal/blockchain"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// binaryMagic starts every binary packet frame. It can never start a JSON packet.
+const binaryMagic = 0xB1
+
+// errShortBuffer is returned when binary data ends in the middle of a value
+var errShortBuffer = errors.New("binary data is truncated")
+
+// errMalformedFrame is returned when a binary frame header is invalid
+var errMalformedFrame = errors.New("malformed binary frame")
+
+// BinaryCodec encodes packets as length-prefixed binary frames. Contents are
+// carried as raw bytes instead of base64, and blocks, headers and data answers
+// are encoded field by field. Other contents fall back to JSON.
+//
+// A frame is the magic byte, the uvarint length of the body and the body. The
+// body holds the ID, type and name, a sender presence byte followed by the
+// sender ID, popularity, host and port, then the content, index and hops.
+// Strings and byte slices are prefixed with their uvarint length and integers
+// are zigzag varints.
+type BinaryCodec struct{}
+
+// Name returns the name of the codec
+func (BinaryCodec) Name() string {
+	return CodecBinary
+}
+
+// Encode encodes a packet as a binary frame
+func (BinaryCodec) Encode(packet *Packet) ([]byte, error) {
+	var body binaryWriter
+	body.string(packet.ID)
+	body.string(string(packet.Type))
+	body.string(string(packet.Name))
+
+	if packet.Sender == nil {
+		body.byte(0)
+	} else {
+		body.byte(1)
+		body.string(packet.Sender.ID)
+		body.int(int64(packet.Sender.Popularity))
+		body.string(packet.Sender.Host)
+		body.int(int64(packet.Sender.Port))
+	}
+
+	body.bytes(packet.Content)
+	body.int(int64(packet.Index))
+	body.int(int64(packet.Hops))
+
+	var frame binaryWriter
+	frame.byte(binaryMagic)
+	frame.bytes(body.buf.Bytes())
+	return frame.buf.Bytes(), nil
+}
+
+// Decode decodes a binary packet frame
+func (c BinaryCodec) Decode(data []byte) (*Packet, error) {
+	frame := binaryReader{data: data}
+	if frame.byte() != binaryMagic {
+		return nil, fmt.Errorf("not a binary packet")
+	}
+
+	body := binaryReader{data: frame.bytes()}
+	if frame.err != nil {
+		return nil, fmt.Errorf("failed to decode packet frame: %w", frame.err)
+	}
+	if frame.remaining() != 0 {
+		return nil, fmt.Errorf("trailing data after packet frame")
+	}
+
+	packet := &Packet{codec: c}
+	packet.ID = body.string()
+	packet.Type = PacketType(body.string())
+	packet.Name = PacketName(body.string())
+
+	switch body.byte() {
+	case 0:
+	case 1:
+		packet.Sender = &Peer{
+			ID:         body.string(),
+			Popularity: int(body.int()),
+			Host:       body.string(),
+			Port:       int(body.int()),
+		}
+	default:
+		return nil, fmt.Errorf("invalid sender presence byte")
+	}
+
+	packet.Content = body.bytes()
+	packet.Index = int(body.int())
+	packet.Hops = int(body.int())
+
+	if body.err != nil {
+		return nil, fmt.Errorf("failed to decode packet: %w", body.err)
+	}
+	if body.remaining() != 0 {
+		return nil, fmt.Errorf("trailing data after packet")
+	}
+
+	return packet, nil
+}
+
+// Marshal encodes blocks, headers and data answers in binary, other contents as JSON
+func (BinaryCodec) Marshal(v interface{}) ([]byte, error) {
+	var w binaryWriter
+
+	switch content := v.(type) {
+	case *blockchain.Block:
+		w.block(content)
+	case []*blockchain.Block:
+		w.blocks(content)
+	case []*blockchain.BlockHeader:
+		w.uint(uint64(len(content)))
+		for _, header := range content {
+			w.header(header)
+		}
+	case dataAnswer:
+		w.blocks(content.Blocks)
+		w.uint(uint64(len(content.NotFound)))
+		for _, item := range content.NotFound {
+			w.string(string(item.Type))
+			w.string(item.Hash)
+		}
+	default:
+		return json.Marshal(v)
+	}
+
+	if w.err != nil {
+		return nil, fmt.Errorf("failed to encode content: %w", w.err)
+	}
+	return w.buf.Bytes(), nil
+}
+
+// Unmarshal decodes contents encoded by Marshal
+func (BinaryCodec) Unmarshal(data []byte, v interface{}) error {
+	r := binaryReader{data: data}
+
+	switch content := v.(type) {
+	case *blockchain.Block:
+		*content = *r.block()
+	case *[]*blockchain.Block:
+		*content = r.blocks()
+	case *[]*blockchain.BlockHeader:
+		count := r.count()
+		headers := make([]*blockchain.BlockHeader, 0, count)
+		for i := 0; i < count && r.err == nil; i++ {
+			headers = append(headers, r.header())
+		}
+		*content = headers
+	case *dataAnswer:
+		content.Blocks = r.blocks()
+		count := r.count()
+		content.NotFound = make([]InvItem, 0, count)
+		for i := 0; i < count && r.err == nil; i++ {
+			content.NotFound = append(content.NotFound, InvItem{Type: InvType(r.string()), Hash: r.string()})
+		}
+	default:
+		return json.Unmarshal(data, v)
+	}
+
+	if r.err != nil {
+		return fmt.Errorf("failed to decode content: %w", r.err)
+	}
+	if r.remaining() != 0 {
+		return fmt.Errorf("trailing data after content")
+	}
+	return nil
+}
+
+// readBinaryFrame reads one binary packet frame
+func readBinaryFrame(r *bufio.Reader) ([]byte, error) {
+	magic, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", errMalformedFrame, err)
+	}
+
+	if length > maxRequestSize {
+		return nil, fmt.Errorf("%w: frame of %d bytes exceeds the maximum size", errMalformedFrame, length)
+	}
+
+	body, err := readFull(r, int(length))
+	if err != nil {
+		return nil, err
+	}
+
+	frame := binary.AppendUvarint([]byte{magic}, length)
+	return append(frame, body...), nil
+}
+
+// binaryWriter appends binary values to a buffer, recording the first error
+type binaryWriter struct {
+	buf bytes.Buffer
+	err error
+}
+
+func (w *binaryWriter) fail(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *binaryWriter) byte(b byte) {
+	w.buf.WriteByte(b)
+}
+
+func (w *binaryWriter) uint(v uint64) {
+	w.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func (w *binaryWriter) int(v int64) {
+	w.buf.Write(binary.AppendVarint(nil, v))
+}
+
+func (w *binaryWriter) bytes(b []byte) {
+	w.uint(uint64(len(b)))
+	w.buf.Write(b)
+}
+
+func (w *binaryWriter) string(s string) {
+	w.uint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *binaryWriter) header(h *blockchain.BlockHeader) {
+	if h == nil {
+		w.fail(errors.New("nil header"))
+		return
+	}
+
+	w.int(int64(h.Index))
+	w.int(h.Timestamp)
+	w.int(int64(h.Difficulty))
+	w.int(int64(h.NextBlockDifficulty))
+	w.string(h.DataHash)
+	w.string(h.Hash)
+	w.string(h.PreviousHash)
+	w.int(int64(h.Nonce))
+	w.uint(h.ExtraNonce)
+	w.string(h.Producer)
+	w.string(h.Signature)
+}
+
+func (w *binaryWriter) block(b *blockchain.Block) {
+	if b == nil {
+		w.fail(errors.New("nil block"))
+		return
+	}
+
+	w.header(&b.BlockHeader)
+	w.string(b.Data)
+}
+
+func (w *binaryWriter) blocks(blocks []*blockchain.Block) {
+	w.uint(uint64(len(blocks)))
+	for _, block := range blocks {
+		w.block(block)
+	}
+}
+
+// binaryReader reads binary values, recording the first error. Reads after
+// an error return zero values.
+type binaryReader struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (r *binaryReader) remaining() int {
+	return len(r.data) - r.off
+}
+
+func (r *binaryReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *binaryReader) byte() byte {
+	if r.err != nil || r.remaining() < 1 {
+		r.fail(errShortBuffer)
+		return 0
+	}
+
+	b := r.data[r.off]
+	r.off++
+	return b
+}
+
+func (r *binaryReader) uint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+
+	v, n := binary.Uvarint(r.data[r.off:])
+	if n <= 0 {
+		r.fail(errShortBuffer)
+		return 0
+	}
+	r.off += n
+	return v
+}
+
+func (r *binaryReader) int() int64 {
+	if r.err != nil {
+		return 0
+	}
+
+	v, n := binary.Varint(r.data[r.off:])
+	if n <= 0 {
+		r.fail(errShortBuffer)
+		return 0
+	}
+	r.off += n
+	return v
+}
+
+func (r *binaryReader) bytes() []byte {
+	length := r.uint()
+	if r.err != nil || length > uint64(r.remaining()) {
+		r.fail(errShortBuffer)
+		return nil
+	}
+
+	b := make([]byte, length)
+	copy(b, r.data[r.off:])
+	r.off += int(length)
+	return b
+}
+
+func (r *binaryReader) string() string {
+	return string(r.bytes())
+}
+
+// count reads a number of elements, bounded by the remaining data so that a
+// corrupted count cannot cause a huge allocation
+func (r *binaryReader) count() int {
+	count := r.uint()
+	if r.err != nil || count > uint64(r.remaining()) {
+		r.fail(errShortBuffer)
+		return 0
+	}
+	return int(count)
+}
+
+func (r *binaryReader) header() *blockchain.BlockHeader {
+	return &blockchain.BlockHeader{
+		Index:               int(r.int()),
+		Timestamp:           r.int(),
+		Difficulty:          int(r.int()),
+		NextBlockDifficulty: int(r.int()),
+		DataHash:            r.string(),
+		Hash:                r.string(),
+		PreviousHash:        r.string(),
+		Nonce:               int(r.int()),
+		ExtraNonce:          r.uint(),
+		Producer:            r.string(),
+		Signature:           r.string(),
+	}
+}
+
+func (r *binaryReader) block() *blockchain.Block {
+	header := r.header()
+	return &blockchain.Block{BlockHeader: *header, Data: r.string()}
+}
+
+func (r *binaryReader) blocks() []*blockchain.Block {
+	count := r.count()
+	blocks := make([]*blockchain.Block, 0, count)
+	for i := 0; i < count && r.err == nil; i++ {
+		blocks = append(blocks, r.block())
+	}
+	return blocks
+}
@@ -5,32 +5,151 @@ import (
 	"time"
 )
 
-// BroadcastManager manages broadcast packet deduplication
+// BroadcastStats holds deduplication metrics of the broadcast manager
+type BroadcastStats struct {
+	Size    int     `json:"size"`
+	Hits    uint64  `json:"hits"`
+	Misses  uint64  `json:"misses"`
+	Evicted uint64  `json:"evicted"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+// broadcastEntry is a processed broadcast message
+type broadcastEntry struct {
+	id     string
+	seenAt time.Time
+}
+
+// BroadcastManager manages broadcast packet deduplication with a bounded,
+// time-expiring cache of message IDs
 type BroadcastManager struct {
-	mu      sync.RWMutex
-	packets map[int]time.Time
+	mu      sync.Mutex
+	ttl     time.Duration
+	maxSize int
+	packets map[string]time.Time
+	order   []broadcastEntry
+	hits    uint64
+	misses  uint64
+	evicted uint64
 }
 
 // NewBroadcastManager creates a new broadcast manager
-func NewBroadcastManager() *BroadcastManager {
+func NewBroadcastManager(ttl time.Duration, maxSize int) *BroadcastManager {
 	return &BroadcastManager{
-		packets: make(map[int]time.Time),
+		ttl:     ttl,
+		maxSize: maxSize,
+		packets: make(map[string]time.Time),
+		order:   make([]broadcastEntry, 0),
 	}
 }
 
-// HasPacket checks if a packet with the given index has been processed
-func (bm *BroadcastManager) HasPacket(index int) bool {
-	bm.mu.RLock()
-	defer bm.mu.RUnlock()
+// HasPacket checks if a packet with the given ID has been processed
+func (bm *BroadcastManager) HasPacket(id string) bool {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
 
-	_, exists := bm.packets[index]
-	return exists
+	return bm.hasPacketInternal(id)
 }
 
 // AddPacket adds a packet to the processed list
-func (bm *BroadcastManager) AddPacket(index int) {
+func (bm *BroadcastManager) AddPacket(id string) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	bm.addPacketInternal(id)
+}
+
+// MarkSeen atomically checks if a packet has been processed and records it.
+// It returns true if the packet had already been seen.
+func (bm *BroadcastManager) MarkSeen(id string) bool {
 	bm.mu.Lock()
 	defer bm.mu.Unlock()
 
-	bm.packets[index] = time.Now()
+	if bm.hasPacketInternal(id) {
+		bm.hits++
+		return true
+	}
+
+	bm.misses++
+	bm.addPacketInternal(id)
+	return false
+}
+
+// hasPacketInternal checks if a non-expired packet exists (internal use, no locking)
+func (bm *BroadcastManager) hasPacketInternal(id string) bool {
+	seenAt, exists := bm.packets[id]
+	return exists && time.Since(seenAt) < bm.ttl
+}
+
+// addPacketInternal records a packet and evicts the oldest ones when the
+// cache is full (internal use, no locking)
+func (bm *BroadcastManager) addPacketInternal(id string) {
+	now := time.Now()
+	bm.packets[id] = now
+	bm.order = append(bm.order, broadcastEntry{id: id, seenAt: now})
+
+	for bm.maxSize > 0 && len(bm.packets) > bm.maxSize && len(bm.order) > 0 {
+		bm.evictOldest()
+	}
+}
+
+// evictOldest removes the oldest entry of the cache (internal use, no locking)
+func (bm *BroadcastManager) evictOldest() {
+	entry := bm.order[0]
+	bm.order = bm.order[1:]
+
+	// Skip entries that were refreshed after being queued
+	if seenAt, exists := bm.packets[entry.id]; exists && seenAt.Equal(entry.seenAt) {
+		delete(bm.packets, entry.id)
+		bm.evicted++
+	}
+}
+
+// Cleanup removes expired entries from the cache
+func (bm *BroadcastManager) Cleanup() {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	for len(bm.order) > 0 && time.Since(bm.order[0].seenAt) >= bm.ttl {
+		bm.evictOldest()
+	}
+
+	// Release the memory of the consumed queue prefix
+	order := make([]broadcastEntry, len(bm.order))
+	copy(order, bm.order)
+	bm.order = order
+}
+
+// StartCleanup periodically removes expired entries from the cache until stop is closed
+func (bm *BroadcastManager) StartCleanup(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			bm.Cleanup()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Stats returns the deduplication metrics
+func (bm *BroadcastManager) Stats() BroadcastStats {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	stats := BroadcastStats{
+		Size:    len(bm.packets),
+		Hits:    bm.hits,
+		Misses:  bm.misses,
+		Evicted: bm.evicted,
+	}
+
+	if total := bm.hits + bm.misses; total > 0 {
+		stats.HitRate = float64(bm.hits) / float64(total)
+	}
+
+	return stats
 }
@@ -0,0 +1,85 @@
+package network
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBroadcastDeduplication(t *testing.T) {
+	bm := NewBroadcastManager(time.Minute, 10)
+
+	if bm.MarkSeen("a") {
+		t.Fatal("first packet reported as seen")
+	}
+	if !bm.MarkSeen("a") {
+		t.Fatal("repeated packet not reported as seen")
+	}
+
+	stats := bm.Stats()
+	if stats.Size != 1 || stats.Hits != 1 || stats.Misses != 1 || stats.HitRate != 0.5 {
+		t.Fatalf("stats %+v, want 1 entry, 1 hit and 1 miss", stats)
+	}
+}
+
+func TestBroadcastExpiry(t *testing.T) {
+	const ttl = 50 * time.Millisecond
+	bm := NewBroadcastManager(ttl, 10)
+
+	bm.AddPacket("old")
+	time.Sleep(ttl)
+	bm.AddPacket("new")
+
+	if bm.HasPacket("old") {
+		t.Fatal("expired packet still seen")
+	}
+	if !bm.HasPacket("new") {
+		t.Fatal("recent packet not seen")
+	}
+
+	bm.Cleanup()
+	if stats := bm.Stats(); stats.Size != 1 || stats.Evicted != 1 {
+		t.Fatalf("stats %+v after cleanup, want 1 entry and 1 eviction", stats)
+	}
+
+	// An expired packet is processed again
+	if bm.MarkSeen("old") {
+		t.Fatal("expired packet reported as seen")
+	}
+}
+
+func TestBroadcastSizeEviction(t *testing.T) {
+	const maxSize = 5
+	bm := NewBroadcastManager(time.Minute, maxSize)
+
+	for i := 0; i < 2*maxSize; i++ {
+		bm.AddPacket(fmt.Sprintf("packet-%d", i))
+	}
+
+	stats := bm.Stats()
+	if stats.Size != maxSize || stats.Evicted != maxSize {
+		t.Fatalf("stats %+v, want %d entries and %d evictions", stats, maxSize, maxSize)
+	}
+
+	// The oldest packets are evicted first
+	for i := 0; i < 2*maxSize; i++ {
+		if seen, want := bm.HasPacket(fmt.Sprintf("packet-%d", i)), i >= maxSize; seen != want {
+			t.Fatalf("packet %d seen %v, want %v", i, seen, want)
+		}
+	}
+}
+
+func TestBroadcastRefreshedEntry(t *testing.T) {
+	bm := NewBroadcastManager(time.Minute, 2)
+
+	bm.AddPacket("a")
+	bm.AddPacket("b")
+	time.Sleep(time.Millisecond)
+	bm.AddPacket("a")
+
+	// The queued entry of the first sighting of a no longer evicts it
+	bm.AddPacket("c")
+	if !bm.HasPacket("a") || bm.HasPacket("b") || !bm.HasPacket("c") {
+		t.Fatal("refreshed packet was evicted instead of the oldest one")
+	}
+}
@@ -0,0 +1,140 @@
+package network
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Names of the wire codecs
+const (
+	CodecJSON   = "json"
+	CodecBinary = "binary"
+)
+
+// Codec encodes packets on the wire, along with the contents of the answers
+// carrying blocks and headers. The codec of a peer is negotiated when joining,
+// and answers always use the codec of their request.
+type Codec interface {
+	// Name returns the name of the codec used during negotiation
+	Name() string
+
+	// Encode encodes a packet as a self-delimited frame
+	Encode(packet *Packet) ([]byte, error)
+
+	// Decode decodes a packet frame
+	Decode(data []byte) (*Packet, error)
+
+	// Marshal encodes a packet content
+	Marshal(v interface{}) ([]byte, error)
+
+	// Unmarshal decodes a packet content
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// codecs holds the supported codecs by name
+var codecs = map[string]Codec{
+	CodecJSON:   JSONCodec{},
+	CodecBinary: BinaryCodec{},
+}
+
+// CodecByName returns the codec with the given name
+func CodecByName(name string) (Codec, error) {
+	codec, exists := codecs[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown codec %q", name)
+	}
+	return codec, nil
+}
+
+// DecodePacket decodes a packet in any supported codec, recognized by its first byte
+func DecodePacket(data []byte) (*Packet, error) {
+	if len(data) > 0 && data[0] == binaryMagic {
+		return BinaryCodec{}.Decode(data)
+	}
+	return JSONCodec{}.Decode(data)
+}
+
+// readPacketData reads exactly one packet frame in any supported codec
+func readPacketData(r *bufio.Reader) ([]byte, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] == binaryMagic {
+		return readBinaryFrame(r)
+	}
+
+	// JSON packets may span several TCP segments
+	var data json.RawMessage
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// negotiateCodec returns the first offered codec that is supported, falling
+// back to JSON which every node understands
+func negotiateCodec(offered, supported []string) string {
+	for _, name := range offered {
+		for _, candidate := range supported {
+			if name == candidate {
+				return name
+			}
+		}
+	}
+	return CodecJSON
+}
+
+// Codec returns the codec the packet was decoded with, JSON for packets created locally
+func (p *Packet) Codec() Codec {
+	if p.codec == nil {
+		return JSONCodec{}
+	}
+	return p.codec
+}
+
+// JSONCodec encodes packets and contents as JSON, which is easy to debug
+type JSONCodec struct{}
+
+// Name returns the name of the codec
+func (JSONCodec) Name() string {
+	return CodecJSON
+}
+
+// Encode encodes a packet as JSON
+func (JSONCodec) Encode(packet *Packet) ([]byte, error) {
+	return packet.ToJSON()
+}
+
+// Decode decodes a JSON packet
+func (c JSONCodec) Decode(data []byte) (*Packet, error) {
+	packet, err := FromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	packet.codec = c
+	return packet, nil
+}
+
+// Marshal encodes a content as JSON
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes a JSON content
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// readFull reads exactly n bytes
+func readFull(r io.Reader, n int) ([]byte, error) {
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,243 @@
+package network
+
+import (
+	"blockchain-go/internal/blockchain"
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// testCodecs are the codecs under test
+var testCodecs = []Codec{JSONCodec{}, BinaryCodec{}}
+
+// testPackets returns a packet of every type and name, with nil, empty and
+// non-empty contents
+func testPackets() []*Packet {
+	names := make([]string, 0, len(packetNames))
+	for name := range packetNames {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	sender := NewPeer("peer-id", 3, "10.0.0.1", 8333)
+	contents := [][]byte{nil, {}, []byte(`{"index":1}`), {0x00, binaryMagic, 0xff}}
+
+	packets := make([]*Packet, 0)
+	for _, name := range names {
+		for _, content := range contents {
+			packets = append(packets, NewPacket(sender, PacketTypeSingle, PacketName(name), content))
+
+			broadcast := NewBroadcastPacket(sender, PacketName(name), content, 42)
+			broadcast.Hops = 2
+			packets = append(packets, broadcast)
+		}
+	}
+
+	// Packets without sender are decoded and rejected by the manager
+	packets = append(packets, NewPacket(nil, PacketTypeSingle, PacketNamePing, nil))
+	return packets
+}
+
+// testBlock returns a block with every header field set
+func testBlock(index int) *blockchain.Block {
+	block := blockchain.NewBlock(index, 2, 3, "block data", "previous-hash")
+	block.Nonce = 12345
+	block.ExtraNonce = 1 << 40
+	block.Producer = "producer-key"
+	block.Hash = block.ComputeHash(blockchain.DefaultPoW)
+	block.Signature = "signature"
+	return block
+}
+
+// samePacket checks that two packets are equal, nil and empty contents being
+// the same content
+func samePacket(a, b *Packet) bool {
+	return a.ID == b.ID && a.Type == b.Type && a.Name == b.Name &&
+		reflect.DeepEqual(a.Sender, b.Sender) && bytes.Equal(a.Content, b.Content) &&
+		a.Index == b.Index && a.Hops == b.Hops
+}
+
+func TestCodecPacketRoundTrip(t *testing.T) {
+	for _, codec := range testCodecs {
+		for _, packet := range testPackets() {
+			data, err := codec.Encode(packet)
+			if err != nil {
+				t.Fatalf("%s: failed to encode %s packet: %v", codec.Name(), packet.Name, err)
+			}
+
+			decoded, err := DecodePacket(data)
+			if err != nil {
+				t.Fatalf("%s: failed to decode %s packet: %v", codec.Name(), packet.Name, err)
+			}
+
+			if !samePacket(packet, decoded) {
+				t.Errorf("%s: %s packet changed in round trip: %+v != %+v", codec.Name(), packet.Name, decoded, packet)
+			}
+
+			if decoded.Codec().Name() != codec.Name() {
+				t.Errorf("%s: packet decoded with codec %s", codec.Name(), decoded.Codec().Name())
+			}
+		}
+	}
+}
+
+func TestCodecContentRoundTrip(t *testing.T) {
+	block := testBlock(7)
+
+	tests := []struct {
+		name    string
+		content interface{}
+		decoded func() interface{}
+	}{
+		{"block", block, func() interface{} { return &blockchain.Block{} }},
+		{"blocks", []*blockchain.Block{testBlock(1), testBlock(2)}, func() interface{} { return &[]*blockchain.Block{} }},
+		{"no blocks", []*blockchain.Block{}, func() interface{} { return &[]*blockchain.Block{} }},
+		{"headers", []*blockchain.BlockHeader{&block.BlockHeader, &testBlock(8).BlockHeader}, func() interface{} { return &[]*blockchain.BlockHeader{} }},
+		{"data answer", dataAnswer{
+			Blocks:   []*blockchain.Block{block},
+			NotFound: []InvItem{{Type: InvTypeBlock, Hash: "missing"}},
+		}, func() interface{} { return &dataAnswer{} }},
+		{"json fallback", headersRequest{StartIndex: 4, Count: 10}, func() interface{} { return &headersRequest{} }},
+	}
+
+	for _, codec := range testCodecs {
+		for _, test := range tests {
+			data, err := codec.Marshal(test.content)
+			if err != nil {
+				t.Fatalf("%s: failed to marshal %s: %v", codec.Name(), test.name, err)
+			}
+
+			decoded := test.decoded()
+			if err := codec.Unmarshal(data, decoded); err != nil {
+				t.Fatalf("%s: failed to unmarshal %s: %v", codec.Name(), test.name, err)
+			}
+
+			// Contents are compared with the pointer decoded into
+			got := reflect.ValueOf(decoded).Elem().Interface()
+			want := test.content
+			if wantBlock, ok := want.(*blockchain.Block); ok {
+				want = *wantBlock
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: %s changed in round trip: %+v != %+v", codec.Name(), test.name, got, want)
+			}
+		}
+	}
+}
+
+func TestBinaryMarshalNilValues(t *testing.T) {
+	contents := map[string]interface{}{
+		"nil block":         (*blockchain.Block)(nil),
+		"nil block in list": []*blockchain.Block{testBlock(1), nil},
+		"nil header":        []*blockchain.BlockHeader{nil},
+		"nil answer block":  dataAnswer{Blocks: []*blockchain.Block{nil}},
+	}
+
+	for name, content := range contents {
+		if _, err := (BinaryCodec{}).Marshal(content); err == nil {
+			t.Errorf("marshaling a %s succeeded", name)
+		}
+	}
+}
+
+// addSeeds adds the encodings of the test packets to a fuzz corpus
+func addSeeds(f *testing.F, codec Codec) {
+	for _, packet := range testPackets() {
+		data, err := codec.Encode(packet)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+}
+
+// checkPacketFixpoint checks that a decoded packet encodes to data decoding to
+// the same packet
+func checkPacketFixpoint(t *testing.T, codec Codec, data []byte) {
+	packet, err := codec.Decode(data)
+	if err != nil {
+		return
+	}
+
+	encoded, err := codec.Encode(packet)
+	if err != nil {
+		t.Fatalf("failed to encode decoded packet: %v", err)
+	}
+
+	decoded, err := codec.Decode(encoded)
+	if err != nil {
+		t.Fatalf("failed to decode encoded packet: %v", err)
+	}
+
+	if !reflect.DeepEqual(packet, decoded) {
+		t.Fatalf("packet changed in round trip: %+v != %+v", decoded, packet)
+	}
+}
+
+// checkContentFixpoint checks that a decoded content marshals to data
+// unmarshaling to the same content
+func checkContentFixpoint(t *testing.T, codec Codec, data []byte, newContent func() interface{}) {
+	content := newContent()
+	if err := codec.Unmarshal(data, content); err != nil {
+		return
+	}
+
+	value := reflect.ValueOf(content).Elem().Interface()
+	if block, ok := content.(*blockchain.Block); ok {
+		value = block
+	}
+
+	encoded, err := codec.Marshal(value)
+	if err != nil {
+		t.Fatalf("failed to marshal decoded %T: %v", content, err)
+	}
+
+	decoded := newContent()
+	if err := codec.Unmarshal(encoded, decoded); err != nil {
+		t.Fatalf("failed to unmarshal marshaled %T: %v", content, err)
+	}
+
+	if !reflect.DeepEqual(content, decoded) {
+		t.Fatalf("%T changed in round trip: %+v != %+v", content, decoded, content)
+	}
+}
+
+func FuzzBinaryDecode(f *testing.F) {
+	codec := BinaryCodec{}
+	addSeeds(f, codec)
+
+	for _, content := range []interface{}{
+		testBlock(1),
+		[]*blockchain.Block{testBlock(1), testBlock(2)},
+		[]*blockchain.BlockHeader{&testBlock(3).BlockHeader},
+		dataAnswer{Blocks: []*blockchain.Block{testBlock(4)}, NotFound: []InvItem{{Type: InvTypeBlock, Hash: "h"}}},
+	} {
+		data, err := codec.Marshal(content)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		checkPacketFixpoint(t, codec, data)
+
+		checkContentFixpoint(t, codec, data, func() interface{} { return &blockchain.Block{} })
+		checkContentFixpoint(t, codec, data, func() interface{} { return &[]*blockchain.Block{} })
+		checkContentFixpoint(t, codec, data, func() interface{} { return &[]*blockchain.BlockHeader{} })
+		checkContentFixpoint(t, codec, data, func() interface{} { return &dataAnswer{} })
+	})
+}
+
+func FuzzJSONDecode(f *testing.F) {
+	codec := JSONCodec{}
+	addSeeds(f, codec)
+	f.Add([]byte(`null`))
+	f.Add([]byte(`{"sender":null,"content":""}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		checkPacketFixpoint(t, codec, data)
+	})
+}
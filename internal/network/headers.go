@@ -0,0 +1,327 @@
+package network
+
+import (
+	"blockchain-go/internal/blockchain"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// maxHeadersPerRequest is the maximum number of headers sent in a GETHEADERS answer
+const maxHeadersPerRequest = 2000
+
+// maxHeadersBeyondAdvertised is the number of headers accepted from a peer
+// beyond the height it advertised when joined, covering the blocks mined since
+const maxHeadersBeyondAdvertised = 1000
+
+// headersRequest is the content of a GETHEADERS packet
+type headersRequest struct {
+	StartIndex int `json:"start_index"`
+	Count      int `json:"count"`
+}
+
+// HeaderChain is a validated header chain downloaded from a peer
+type HeaderChain struct {
+	Peer    *Peer
+	Headers []*blockchain.BlockHeader
+}
+
+// HasHeader checks if the chain contains the given header
+func (hc *HeaderChain) HasHeader(header *blockchain.BlockHeader) bool {
+	return header.Index < len(hc.Headers) && hc.Headers[header.Index].Hash == header.Hash
+}
+
+// handleGetHeaders answers a GETHEADERS request with a range of headers
+func (m *Manager) handleGetHeaders(packet *Packet) ([]byte, error) {
+	var request headersRequest
+	if err := json.Unmarshal(packet.Content, &request); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal headers request: %w", err)
+	}
+
+	if request.Count > maxHeadersPerRequest {
+		request.Count = maxHeadersPerRequest
+	}
+
+	headers, err := m.blockchain.GetHeaders(request.StartIndex, request.Count)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get headers: %w", err)
+	}
+
+	headersData, err := packet.Codec().Marshal(headers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal headers: %w", err)
+	}
+
+	response := NewPacket(m.me, PacketTypeSingle, PacketNameGetHeadersAnswer, headersData)
+	return packet.Codec().Encode(response)
+}
+
+// handleGetHeadersAnswer handles a GETHEADERS answer
+func (m *Manager) handleGetHeadersAnswer(packet *Packet) ([]byte, error) {
+	return []byte{}, nil
+}
+
+// GetHeaders requests up to count headers starting at startIndex from a peer
+func (m *Manager) GetHeaders(peer *Peer, startIndex, count int) ([]*blockchain.BlockHeader, error) {
+	if peer == nil {
+		return nil, fmt.Errorf("cannot get headers from nil peer")
+	}
+
+	requestData, err := json.Marshal(headersRequest{StartIndex: startIndex, Count: count})
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize headers request: %w", err)
+	}
+
+	responsePacket, _, err := m.request(peer, NewPacket(m.me, PacketTypeSingle, PacketNameGetHeaders, requestData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send headers request: %w", err)
+	}
+
+	var headers []*blockchain.BlockHeader
+	if err := responsePacket.Codec().Unmarshal(responsePacket.Content, &headers); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal headers: %w", err)
+	}
+
+	return headers, nil
+}
+
+// DownloadHeaderChain downloads and validates the whole header chain of a peer,
+// charging invalid headers to the given address, the remote address of the
+// connections to the peer. The chain may not exceed the height the peer
+// advertised when we joined it by more than maxHeadersBeyondAdvertised.
+func (m *Manager) DownloadHeaderChain(address string, peer *Peer) ([]*blockchain.BlockHeader, error) {
+	pow := m.blockchain.GetPoW()
+	rules := m.blockchain.GetDifficultyRules()
+	limit := peer.advertisedHeight + 1 + maxHeadersBeyondAdvertised
+
+	headers := make([]*blockchain.BlockHeader, 0)
+	headerAt := func(index int) *blockchain.BlockHeader {
+		return headers[index]
+	}
+
+	for {
+		batch, err := m.GetHeaders(peer, len(headers), maxHeadersPerRequest)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, header := range batch {
+			if header == nil {
+				m.Misbehaving(address, MisbehaviorMalformedPacket, "nil header")
+				return nil, fmt.Errorf("peer sent a nil header")
+			}
+
+			if len(headers) >= limit {
+				return nil, fmt.Errorf("peer %s sent more headers than its advertised height %d allows",
+					peer.GetAddress(), peer.advertisedHeight)
+			}
+
+			if len(headers) == 0 {
+				err = blockchain.ValidateHeaderChain(pow, rules, []*blockchain.BlockHeader{header})
+			} else {
+				previous := headers[len(headers)-1]
+				err = blockchain.ValidateNextHeader(pow, previous, header)
+				if err == nil {
+					err = rules.ValidateNextDifficulty(previous, header, headerAt)
+				}
+			}
+
+			if err != nil {
+				m.Misbehaving(address, MisbehaviorInvalidBlock, "invalid header chain")
+				return nil, fmt.Errorf("invalid header #%d: %w", header.Index, err)
+			}
+			headers = append(headers, header)
+		}
+
+		if len(batch) < maxHeadersPerRequest {
+			break
+		}
+	}
+
+	if len(headers) == 0 {
+		return nil, fmt.Errorf("peer %s has no headers", peer.GetAddress())
+	}
+
+	return headers, nil
+}
+
+// DownloadHeaderChains downloads the header chains of several peers
+// concurrently and returns the valid ones
+func (m *Manager) DownloadHeaderChains(peers []*Peer) []*HeaderChain {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		chains = make([]*HeaderChain, 0, len(peers))
+	)
+
+	for _, peer := range peers {
+		wg.Add(1)
+		go func(p *Peer) {
+			defer wg.Done()
+
+			// Sync peers are dialed at their host
+			headers, err := m.DownloadHeaderChain(p.Host, p)
+			if err != nil {
+				log.Printf("Failed to download headers from %s: %v", p.String(), err)
+				return
+			}
+
+			mu.Lock()
+			chains = append(chains, &HeaderChain{Peer: p, Headers: headers})
+			mu.Unlock()
+		}(peer)
+	}
+	wg.Wait()
+
+	return chains
+}
+
+// SelectBestHeaderChain returns the header chain with the most work
+func SelectBestHeaderChain(chains []*HeaderChain) (*HeaderChain, error) {
+	var best *HeaderChain
+	for _, chain := range chains {
+		if best == nil {
+			best = chain
+			continue
+		}
+
+		cmp := blockchain.ChainWork(chain.Headers).Cmp(blockchain.ChainWork(best.Headers))
+		if cmp > 0 || (cmp == 0 && len(chain.Headers) > len(best.Headers)) {
+			best = chain
+		}
+	}
+
+	if best == nil {
+		return nil, fmt.Errorf("no peer provided a valid header chain")
+	}
+
+	return best, nil
+}
+
+// downloadBodyBatch downloads the blocks of consecutive headers in a single
+// request, charging missing or mismatching blocks to the given address
+func (m *Manager) downloadBodyBatch(address string, peer *Peer, headers []*blockchain.BlockHeader) ([]*blockchain.Block, error) {
+	items := make([]InvItem, len(headers))
+	for i, header := range headers {
+		items[i] = InvItem{Type: InvTypeBlock, Hash: header.Hash}
+	}
+
+	received, _, err := m.GetData(peer, items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download blocks: %w", err)
+	}
+
+	byHash := make(map[string]*blockchain.Block, len(received))
+	for _, block := range received {
+		byHash[block.Hash] = block
+	}
+
+	blocks := make([]*blockchain.Block, len(headers))
+	for i, header := range headers {
+		block, exists := byHash[header.Hash]
+		if !exists {
+			m.Misbehaving(address, MisbehaviorBogusInventory, "block of announced header not found")
+			return nil, fmt.Errorf("block #%d not provided by peer", header.Index)
+		}
+
+		if block.BlockHeader != *header || block.IsValid(m.blockchain.GetPoW()) != nil {
+			m.Misbehaving(address, MisbehaviorInvalidBlock, "block does not match its header")
+			return nil, fmt.Errorf("block #%d does not match its header", header.Index)
+		}
+		blocks[i] = block
+	}
+
+	return blocks, nil
+}
+
+// SyncHeadersFirst synchronizes an empty blockchain by selecting the best
+// header chain among the given peers before downloading the block bodies in
+// parallel from every peer sharing that chain. Every block goes through the
+// consensus rules; a peer serving an invalid block is banned and the sync is
+// retried with the remaining peers.
+func (m *Manager) SyncHeadersFirst(peers []*Peer) error {
+	// Hosts are excluded even when their ban expires right away
+	failed := make(map[string]bool)
+
+	for {
+		candidates := make([]*Peer, 0, len(peers))
+		for _, peer := range peers {
+			if !failed[peer.Host] && !m.banManager.IsBanned(peer.Host) {
+				candidates = append(candidates, peer)
+			}
+		}
+
+		if len(candidates) == 0 {
+			return fmt.Errorf("no peer left to sync from")
+		}
+
+		err := m.syncHeadersFirst(candidates)
+		if err == nil {
+			return nil
+		}
+
+		var blockErr *invalidSyncBlockError
+		if !errors.As(err, &blockErr) {
+			return err
+		}
+		failed[blockErr.host] = true
+
+		log.Printf("Sync failed, retrying with the remaining peers: %v", err)
+		m.blockchain.Reset()
+	}
+}
+
+// invalidSyncBlockError is returned when a peer served a block violating the
+// consensus rules
+type invalidSyncBlockError struct {
+	host  string
+	index int
+	from  string
+	err   error
+}
+
+func (e *invalidSyncBlockError) Error() string {
+	return fmt.Sprintf("invalid block #%d from %s: %v", e.index, e.from, e.err)
+}
+
+// syncHeadersFirst runs a single headers-first synchronization attempt
+func (m *Manager) syncHeadersFirst(peers []*Peer) error {
+	if m.blockchain.GetChainLength() != 0 {
+		return fmt.Errorf("headers-first sync requires an empty blockchain")
+	}
+
+	chains := m.DownloadHeaderChains(peers)
+
+	best, err := SelectBestHeaderChain(chains)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Selected header chain of %d headers from %s", len(best.Headers), best.Peer.String())
+
+	// Feed the downloaded blocks in order through the consensus rules
+	scheduler := NewDownloadScheduler(m, best.Headers, chains, func(peer *Peer, blocks []*blockchain.Block) error {
+		for _, block := range blocks {
+			var err error
+			if block.Index == 0 {
+				err = m.blockchain.AddGenesisBlock(block)
+			} else {
+				err = m.blockchain.AddBlock(block)
+			}
+
+			if err != nil {
+				m.BanPeer(peer.Host, "served an invalid block during sync")
+				return &invalidSyncBlockError{host: peer.Host, index: block.Index, from: peer.GetAddress(), err: err}
+			}
+		}
+		return nil
+	})
+
+	if err := scheduler.Run(); err != nil {
+		return fmt.Errorf("failed to download bodies: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package network
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// identityPEMType is the PEM block type of a persisted identity key
+const identityPEMType = "PRIVATE KEY"
+
+// Identity is the long-term key pair of a node. The peer ID of a node is
+// derived from its public key, so that peers can verify who they talk to.
+type Identity struct {
+	PrivateKey ed25519.PrivateKey
+	PublicKey  ed25519.PublicKey
+}
+
+// GenerateIdentity creates a new random identity
+func GenerateIdentity() (*Identity, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate identity key: %w", err)
+	}
+
+	return &Identity{PrivateKey: privateKey, PublicKey: publicKey}, nil
+}
+
+// LoadIdentity loads the identity stored at path, creating and saving a new
+// one if the file does not exist. An empty path gives an ephemeral identity.
+// A new identity that could not be saved is returned along with the error.
+func LoadIdentity(path string) (*Identity, error) {
+	if path == "" {
+		return GenerateIdentity()
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		identity, err := GenerateIdentity()
+		if err != nil {
+			return nil, err
+		}
+		return identity, identity.Save(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != identityPEMType {
+		return nil, fmt.Errorf("identity file %s contains no private key", path)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse identity key: %w", err)
+	}
+
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("identity key in %s is not an ed25519 key", path)
+	}
+
+	return &Identity{
+		PrivateKey: privateKey,
+		PublicKey:  privateKey.Public().(ed25519.PublicKey),
+	}, nil
+}
+
+// Save writes the private key of the identity to path
+func (id *Identity) Save(path string) error {
+	der, err := x509.MarshalPKCS8PrivateKey(id.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to marshal identity key: %w", err)
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: identityPEMType, Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write identity file: %w", err)
+	}
+
+	return nil
+}
+
+// PeerID returns the peer ID derived from the identity public key
+func (id *Identity) PeerID() string {
+	return PeerIDFromPublicKey(id.PublicKey)
+}
+
+// PeerIDFromPublicKey derives a peer ID from a node public key
+func PeerIDFromPublicKey(publicKey ed25519.PublicKey) string {
+	hash := sha512.Sum512(publicKey)
+	return base64.URLEncoding.EncodeToString(hash[:])[:32]
+}
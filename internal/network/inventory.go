@@ -0,0 +1,337 @@
+package network
+
+import (
+	"blockchain-go/internal/blockchain"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// maxForkDepth is the maximum number of ancestors fetched to connect a fork
+const maxForkDepth = 500
+
+// maxItemsPerRequest is the maximum number of items answered in a GETDATA request
+const maxItemsPerRequest = 500
+
+// InvType represents the type of an inventory item
+type InvType string
+
+const (
+	InvTypeBlock InvType = "BLOCK"
+	// InvTypeTransaction is reserved for transactions, which are not
+	// implemented yet: requests for them are always answered with NOTFOUND
+	InvTypeTransaction InvType = "TX"
+)
+
+// InvItem identifies an object announced or requested by hash
+type InvItem struct {
+	Type InvType `json:"type"`
+	Hash string  `json:"hash"`
+}
+
+// dataAnswer is the content of GETDATAANSWER and NOTFOUND packets
+type dataAnswer struct {
+	Blocks   []*blockchain.Block `json:"blocks"`
+	NotFound []InvItem           `json:"not_found"`
+}
+
+// NewInvPacket creates a broadcast packet announcing inventory items
+func NewInvPacket(sender *Peer, items []InvItem, index int) (*Packet, error) {
+	content, err := json.Marshal(items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal inventory: %w", err)
+	}
+
+	return NewBroadcastPacket(sender, PacketNameInv, content, index), nil
+}
+
+// AnnounceBlock broadcasts an inventory announcement of a block to all peers
+func (m *Manager) AnnounceBlock(block *blockchain.Block) error {
+	packet, err := NewInvPacket(m.me, []InvItem{{Type: InvTypeBlock, Hash: block.Hash}}, block.Index)
+	if err != nil {
+		return err
+	}
+
+	packetData, err := packet.ToJSON()
+	if err != nil {
+		return fmt.Errorf("failed to serialize inventory packet: %w", err)
+	}
+
+	m.Broadcast(packetData)
+	return nil
+}
+
+// handleInv handles an inventory announcement by fetching the missing items
+func (m *Manager) handleInv(address string, packet *Packet) ([]byte, error) {
+	var items []InvItem
+	if err := json.Unmarshal(packet.Content, &items); err != nil {
+		m.Misbehaving(address, MisbehaviorMalformedPacket, "malformed inventory")
+		return []byte{}, nil
+	}
+
+	missing := make([]InvItem, 0)
+	for _, item := range items {
+		if item.Type == InvTypeBlock && !m.blockchain.HasBlockHash(item.Hash) {
+			missing = append(missing, item)
+		}
+	}
+
+	if len(missing) > 0 {
+		if err := m.fetchBlocks(address, packet.Sender, missing); err != nil {
+			log.Printf("Failed to fetch announced blocks from %s: %v", packet.Sender.String(), err)
+			return []byte{}, nil
+		}
+	}
+
+	// Only relay announcements of blocks we hold in our validated chain
+	for _, item := range items {
+		if item.Type == InvTypeBlock && !m.blockchain.HasBlockHash(item.Hash) {
+			return []byte{}, nil
+		}
+	}
+	m.relayBroadcast(packet)
+
+	return []byte{}, nil
+}
+
+// handleGetData answers a GETDATA request with the requested blocks
+func (m *Manager) handleGetData(packet *Packet) ([]byte, error) {
+	var items []InvItem
+	if err := json.Unmarshal(packet.Content, &items); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal data request: %w", err)
+	}
+
+	if len(items) > maxItemsPerRequest {
+		items = items[:maxItemsPerRequest]
+	}
+
+	answer := dataAnswer{
+		Blocks:   make([]*blockchain.Block, 0, len(items)),
+		NotFound: make([]InvItem, 0),
+	}
+
+	for _, item := range items {
+		if item.Type != InvTypeBlock {
+			answer.NotFound = append(answer.NotFound, item)
+			continue
+		}
+
+		block, err := m.blockchain.GetBlockByHash(item.Hash)
+		if err != nil {
+			answer.NotFound = append(answer.NotFound, item)
+			continue
+		}
+		answer.Blocks = append(answer.Blocks, block)
+	}
+
+	answerData, err := packet.Codec().Marshal(answer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal data answer: %w", err)
+	}
+
+	name := PacketNameGetDataAnswer
+	if len(answer.NotFound) > 0 {
+		name = PacketNameNotFound
+	}
+
+	response := NewPacket(m.me, PacketTypeSingle, name, answerData)
+	return packet.Codec().Encode(response)
+}
+
+// handleGetDataAnswer handles a GETDATA answer
+func (m *Manager) handleGetDataAnswer(packet *Packet) ([]byte, error) {
+	return []byte{}, nil
+}
+
+// handleNotFound handles a NOTFOUND answer
+func (m *Manager) handleNotFound(packet *Packet) ([]byte, error) {
+	return []byte{}, nil
+}
+
+// GetData requests inventory items from a peer and returns the blocks it holds
+// along with the items it reported as not found
+func (m *Manager) GetData(peer *Peer, items []InvItem) ([]*blockchain.Block, []InvItem, error) {
+	if peer == nil {
+		return nil, nil, fmt.Errorf("cannot get data from nil peer")
+	}
+
+	requestData, err := json.Marshal(items)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to serialize data request: %w", err)
+	}
+
+	responsePacket, _, err := m.request(peer, NewPacket(m.me, PacketTypeSingle, PacketNameGetData, requestData))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to send data request: %w", err)
+	}
+
+	if responsePacket.Name != PacketNameGetDataAnswer && responsePacket.Name != PacketNameNotFound {
+		return nil, nil, fmt.Errorf("unexpected answer %s to data request", responsePacket.Name)
+	}
+
+	var answer dataAnswer
+	if err := responsePacket.Codec().Unmarshal(responsePacket.Content, &answer); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal data answer: %w", err)
+	}
+
+	// Only keep the blocks that were actually requested
+	requested := make(map[string]bool, len(items))
+	for _, item := range items {
+		requested[item.Hash] = true
+	}
+
+	blocks := make([]*blockchain.Block, 0, len(answer.Blocks))
+	for _, block := range answer.Blocks {
+		if block != nil && requested[block.Hash] {
+			blocks = append(blocks, block)
+		}
+	}
+
+	return blocks, answer.NotFound, nil
+}
+
+// fetchBlocks downloads blocks announced from the given address from a peer
+// and adds them to the chain. Misbehavior is charged to the announcing address,
+// as the peer is named by the announcement and may not be the one that sent it.
+func (m *Manager) fetchBlocks(address string, peer *Peer, items []InvItem) error {
+	blocks, notFound, err := m.GetData(peer, items)
+	if err != nil {
+		return err
+	}
+
+	if len(notFound) > 0 {
+		m.Misbehaving(address, MisbehaviorBogusInventory, "announced items not found")
+	}
+
+	for _, block := range blocks {
+		if err := m.acceptBlock(address, peer, block); err != nil {
+			return fmt.Errorf("cannot accept block %s: %w", block.Hash, err)
+		}
+		m.recordPeerBlock(peer)
+	}
+
+	return nil
+}
+
+// acceptBlock adds a block received from a peer to the chain, fetching its
+// missing ancestors and switching to its branch if it carries more work.
+// Misbehavior is charged to the address that announced the block.
+func (m *Manager) acceptBlock(address string, peer *Peer, block *blockchain.Block) error {
+	if m.blockchain.HasBlockHash(block.Hash) {
+		return nil
+	}
+
+	if err := block.IsValid(m.blockchain.GetPoW()); err != nil {
+		m.Misbehaving(address, MisbehaviorInvalidBlock, "invalid block")
+		return err
+	}
+
+	// Extend the tip of our chain
+	if err := m.blockchain.AddBlock(block); err == nil {
+		return nil
+	}
+
+	branch, err := m.fetchBranch(address, peer, block)
+	if err != nil {
+		return err
+	}
+
+	// Competing branches with less work than ours are ignored
+	if err := m.blockchain.Reorganize(branch); err != nil {
+		return fmt.Errorf("branch not adopted: %w", err)
+	}
+
+	return nil
+}
+
+// fetchBranch returns the branch of a fork block down to our chain. The fork
+// point is located from the headers of the peer, and the missing ancestors are
+// downloaded in windows rather than one request per block.
+func (m *Manager) fetchBranch(address string, peer *Peer, block *blockchain.Block) ([]*blockchain.Block, error) {
+	if m.blockchain.HasBlockHash(block.PreviousHash) {
+		return []*blockchain.Block{block}, nil
+	}
+
+	// The genesis block is shared by every chain
+	start := block.Index - maxForkDepth
+	if start < 1 {
+		start = 1
+	}
+	if start >= block.Index {
+		return nil, fmt.Errorf("fork of block %s does not connect to our chain", block.Hash)
+	}
+
+	headers, err := m.GetHeaders(peer, start, block.Index-start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch fork headers: %w", err)
+	}
+
+	// The headers must lead to the announced block; a peer that switched
+	// branches since announcing it is not at fault
+	for i, header := range headers {
+		if header == nil {
+			m.Misbehaving(address, MisbehaviorMalformedPacket, "nil header")
+			return nil, fmt.Errorf("peer sent a nil header")
+		}
+		if header.Index != start+i {
+			return nil, fmt.Errorf("fork header #%d received out of order", header.Index)
+		}
+	}
+	if len(headers) != block.Index-start || headers[len(headers)-1].Hash != block.PreviousHash {
+		return nil, fmt.Errorf("fork of block %s is no longer the chain of the peer", block.Hash)
+	}
+
+	// Skip the headers already in our chain
+	fork := len(headers) - 1
+	for fork >= 0 {
+		ours, err := m.blockchain.GetBlock(headers[fork].Index)
+		if err == nil && ours.Hash == headers[fork].Hash {
+			break
+		}
+		fork--
+	}
+	if fork < 0 {
+		parent, err := m.blockchain.GetBlock(start - 1)
+		if err != nil || parent.Hash != headers[0].PreviousHash {
+			return nil, fmt.Errorf("fork of block %s does not connect to our chain within %d blocks", block.Hash, maxForkDepth)
+		}
+	}
+	missing := headers[fork+1:]
+
+	// Only download the bodies of a branch carrying more work than ours
+	forkHeaders := append(append([]*blockchain.BlockHeader(nil), missing...), &block.BlockHeader)
+	if blockchain.ChainWork(forkHeaders).Cmp(m.blockchain.WorkAfter(start+fork)) <= 0 {
+		return nil, fmt.Errorf("fork of block %s does not carry more work than our chain", block.Hash)
+	}
+
+	windowSize := m.downloadWindowSize()
+	branch := make([]*blockchain.Block, 0, len(missing)+1)
+	for len(missing) > 0 {
+		count := windowSize
+		if count > len(missing) {
+			count = len(missing)
+		}
+
+		blocks, err := m.downloadBodyBatch(address, peer, missing[:count])
+		if err != nil {
+			return nil, err
+		}
+		branch = append(branch, blocks...)
+		missing = missing[count:]
+	}
+
+	return append(branch, block), nil
+}
+
+// downloadWindowSize returns the number of blocks requested at once, within
+// the number of items peers answer
+func (m *Manager) downloadWindowSize() int {
+	windowSize := m.config.DownloadWindowSize
+	if windowSize <= 0 {
+		windowSize = 100
+	}
+	if windowSize > maxItemsPerRequest {
+		windowSize = maxItemsPerRequest
+	}
+	return windowSize
+}
@@ -0,0 +1,146 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// StartPeerMonitor periodically pings every peer and evicts the dead ones
+// until Shutdown is called
+func (m *Manager) StartPeerMonitor() {
+	if m.config.PingInterval <= 0 {
+		log.Println("Peer monitor disabled")
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(m.config.PingInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.pingPeers()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// pingPeers pings all known peers concurrently
+func (m *Manager) pingPeers() {
+	m.mu.RLock()
+	peers := make([]*Peer, len(m.peers))
+	copy(peers, m.peers)
+	m.mu.RUnlock()
+
+	for _, peer := range peers {
+		if peer == nil {
+			continue
+		}
+
+		go func(p *Peer) {
+			if _, err := m.Ping(p); err != nil {
+				log.Printf("Ping to peer %s failed: %v", p.String(), err)
+			}
+		}(peer)
+	}
+}
+
+// Ping sends a PING to a peer and returns the measured round-trip time
+func (m *Manager) Ping(peer *Peer) (time.Duration, error) {
+	if peer == nil {
+		return 0, fmt.Errorf("cannot ping nil peer")
+	}
+
+	start := time.Now()
+	responsePacket, _, err := m.request(peer, NewPacket(m.me, PacketTypeSingle, PacketNamePing, nil))
+	if err != nil && !errors.Is(err, errNoAnswer) {
+		m.recordPeerFailure(peer)
+		return 0, fmt.Errorf("failed to send ping: %w", err)
+	}
+	rtt := time.Since(start)
+
+	if responsePacket == nil || responsePacket.Name != PacketNamePong {
+		m.recordPeerFailure(peer)
+		return 0, fmt.Errorf("invalid ping answer from peer %s", peer.GetAddress())
+	}
+
+	m.recordPeerSuccess(peer, rtt)
+	return rtt, nil
+}
+
+// handlePing answers a ping request
+func (m *Manager) handlePing(packet *Packet) ([]byte, error) {
+	response := NewPacket(m.me, PacketTypeSingle, PacketNamePong, nil)
+	return packet.Codec().Encode(response)
+}
+
+// handlePong handles a ping answer
+func (m *Manager) handlePong(packet *Packet) ([]byte, error) {
+	return []byte{}, nil
+}
+
+// recordPeerSuccess resets the failure counter of a peer and stores its latency
+func (m *Manager) recordPeerSuccess(peer *Peer, rtt time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range m.peers {
+		if p.IsEqual(peer) {
+			p.failures = 0
+			p.lastSeen = time.Now()
+			if rtt > 0 {
+				p.latency = rtt
+			}
+			return
+		}
+	}
+}
+
+// recordPeerFailure increments the failure counter of a peer and evicts it
+// once it reaches the configured number of consecutive failures
+func (m *Manager) recordPeerFailure(peer *Peer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range m.peers {
+		if !p.IsEqual(peer) {
+			continue
+		}
+
+		p.failures++
+		if m.config.MaxPeerFailures > 0 && p.failures >= m.config.MaxPeerFailures {
+			m.removePeerInternal(p)
+			log.Printf("Evicted peer %s after %d consecutive failures", p.String(), p.failures)
+		}
+		return
+	}
+}
+
+// GetPeers returns a snapshot of the known peers with their liveness information
+func (m *Manager) GetPeers() []PeerInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	peers := make([]PeerInfo, 0, len(m.peers))
+	for _, p := range m.peers {
+		if p == nil {
+			continue
+		}
+
+		peers = append(peers, PeerInfo{
+			ID:         p.ID,
+			Popularity: p.Popularity,
+			Host:       p.Host,
+			Port:       p.Port,
+			Latency:    p.latency,
+			Failures:   p.failures,
+			LastSeen:   p.lastSeen,
+			Inbound:    p.inbound,
+			LastBlock:  p.lastBlock,
+		})
+	}
+	return peers
+}
@@ -3,8 +3,13 @@ package network
 import (
 	"blockchain-go/internal/blockchain"
 	"blockchain-go/internal/config"
+	"bufio"
+	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"strconv"
@@ -12,6 +17,24 @@ import (
 	"time"
 )
 
+// maxRequestSize is the maximum size of a packet read from a connection
+const maxRequestSize = 4 * 1024 * 1024
+
+// maxBlocksPerDownload is the maximum number of blocks served for a DOWNLOADBLOCK request
+const maxBlocksPerDownload = 500
+
+// broadcastCleanupInterval is the interval between broadcast cache cleanups
+const broadcastCleanupInterval = 30 * time.Second
+
+// errUnknownPacket is returned for packets with an unknown type or name
+var errUnknownPacket = errors.New("unknown packet")
+
+// errRateLimited is returned for packets exceeding the rate limits of their sender
+var errRateLimited = errors.New("rate limit exceeded")
+
+// errNoAnswer is returned when a peer closes the connection without answering
+var errNoAnswer = errors.New("peer sent no answer")
+
 // Manager handles network communication and peer management
 type Manager struct {
 	mu               sync.RWMutex
@@ -21,62 +44,268 @@ type Manager struct {
 	lastBlockIndex   int
 	config           config.NetworkConfig
 	broadcastManager *BroadcastManager
+	banManager       *BanManager
+	identity         *Identity
+	codec            Codec
+	transport        Transport
+	connSlots        chan struct{}
+	rateLimiter      *RateLimiter
+	bandwidth        *BandwidthMeter
+
+	// Lifecycle of the server and the background tasks, guarded by mu
+	listener    net.Listener
+	stop        chan struct{}
+	stopped     bool
+	connections sync.WaitGroup
 }
 
-// NewManager creates a new network manager
+// NewManager creates a new network manager communicating over TCP
 func NewManager(cfg config.NetworkConfig, bc *blockchain.Blockchain) *Manager {
-	peerID := GeneratePeerID()
-	me := NewPeer(peerID, 0, cfg.Host, cfg.Port)
+	return NewManagerWithTransport(cfg, bc, TCPTransport{})
+}
+
+// NewManagerWithTransport creates a new network manager communicating through
+// the given transport, secured with the node identity when encryption is enabled
+func NewManagerWithTransport(cfg config.NetworkConfig, bc *blockchain.Blockchain, transport Transport) *Manager {
+	identity, err := LoadIdentity(cfg.IdentityFile)
+	if err != nil && identity != nil {
+		// A new identity that could not be saved lasts until the node restarts
+		log.Printf("Failed to save identity: %v", err)
+	} else if err != nil {
+		log.Printf("Failed to load identity: %v, using an ephemeral identity", err)
+		if identity, err = GenerateIdentity(); err != nil {
+			log.Fatalf("Failed to generate identity: %v", err)
+		}
+	}
+	me := NewPeer(identity.PeerID(), 0, cfg.Host, cfg.Port)
+	log.Printf("Node identity %s (public key %s)", me.ID, blockchain.EncodePublicKey(identity.PublicKey))
+
+	// Permissioned networks authenticate every connection against the membership
+	if bc.IsPermissioned() && !cfg.Encryption {
+		log.Println("Permissioned mode requires encryption, enabling it")
+		cfg.Encryption = true
+	}
+
+	if cfg.Encryption {
+		secureTransport, err := NewSecureTransport(transport, identity)
+		if err != nil {
+			log.Fatalf("Failed to set up encrypted transport: %v", err)
+		}
+
+		if bc.IsPermissioned() {
+			secureTransport.SetAuthorizer(func(publicKey ed25519.PublicKey) error {
+				return authorizeMember(bc, publicKey)
+			})
+		}
+		transport = secureTransport
+	}
+
+	codec, err := CodecByName(cfg.Codec)
+	if err != nil {
+		log.Printf("Invalid wire codec: %v, using %s", err, CodecJSON)
+		codec = JSONCodec{}
+	}
+
+	banManager, err := NewBanManager(cfg.BanFile, cfg.BanThreshold, time.Duration(cfg.BanDuration)*time.Second)
+	if err != nil {
+		log.Printf("Failed to load bans: %v", err)
+	}
+
+	// Bounds the number of inbound connections handled at once
+	var connSlots chan struct{}
+	if cfg.MaxConnections > 0 {
+		connSlots = make(chan struct{}, cfg.MaxConnections)
+	}
+
+	stop := make(chan struct{})
+	broadcastManager := NewBroadcastManager(time.Duration(cfg.BroadcastCacheTTL)*time.Second, cfg.BroadcastCacheSize)
+	go broadcastManager.StartCleanup(broadcastCleanupInterval, stop)
 
 	return &Manager{
 		me:               me,
 		blockchain:       bc,
 		peers:            make([]*Peer, 0),
 		config:           cfg,
-		broadcastManager: NewBroadcastManager(),
+		broadcastManager: broadcastManager,
+		banManager:       banManager,
+		identity:         identity,
+		codec:            codec,
+		transport:        transport,
+		connSlots:        connSlots,
+		rateLimiter:      NewRateLimiter(config.RateLimitConfig{Rate: cfg.PeerMessageRate, Burst: cfg.PeerMessageBurst}, cfg.MessageRateLimits),
+		bandwidth:        NewBandwidthMeter(cfg.MaxUploadRate),
+		stop:             stop,
 	}
 }
 
 // NewJoiningManager creates a network manager that joins an existing network
-func NewJoiningManager(cfg config.NetworkConfig, bc *blockchain.Blockchain, initHost string, initPort int) *Manager {
+// and synchronizes the blockchain from it
+func NewJoiningManager(cfg config.NetworkConfig, bc *blockchain.Blockchain, initHost string, initPort int) (*Manager, error) {
 	manager := NewManager(cfg, bc)
 
-	// Add initial peer
-	initPeer := NewPeer("0", 0, initHost, initPort)
-	manager.AddPeer(initPeer)
+	if err := manager.Join(initHost, initPort); err != nil {
+		return nil, err
+	}
+
+	return manager, nil
+}
+
+// Join joins an existing network through the initial peer and the configured
+// seed peers, and synchronizes the blockchain from them
+func (m *Manager) Join(initHost string, initPort int) error {
+	cfg := m.config
+
+	// Collect the initial peer and the configured seed peers
+	initPeers := []*Peer{NewPeer(unknownPeerID, 0, initHost, initPort)}
+	for _, address := range cfg.SeedPeers {
+		seedPeer, err := NewPeerFromAddress(address)
+		if err != nil {
+			log.Printf("Ignoring seed peer: %v", err)
+			continue
+		}
+		initPeers = append(initPeers, seedPeer)
+	}
+
+	// Join the network through every reachable peer
+	joinedPeers := make([]*Peer, 0, len(initPeers))
+	for _, initPeer := range initPeers {
+		if !m.HasOutboundSlot() {
+			log.Printf("Outbound peer slots are full, not joining through %s", initPeer.GetAddress())
+			break
+		}
+
+		m.AddPeer(initPeer)
+
+		if err := m.joinNetwork(initPeer); err != nil {
+			log.Printf("Failed to join network through %s: %v", initPeer.GetAddress(), err)
+			continue
+		}
+		joinedPeers = append(joinedPeers, initPeer)
+	}
 
-	// Join the network
-	if err := manager.joinNetwork(initPeer); err != nil {
-		log.Printf("Failed to join network: %v", err)
-		return manager
+	if len(joinedPeers) == 0 {
+		return fmt.Errorf("no reachable peer")
 	}
 
-	// Sync the full chain from the peer
-	if err := manager.SyncFullChainFromPeer(initPeer); err != nil {
-		log.Fatalf("Failed to sync blockchain from peer: %v", err)
+	// Sync the chain, headers first, from the joined peers
+	if err := m.SyncHeadersFirst(joinedPeers); err != nil {
+		return fmt.Errorf("failed to sync blockchain from peers: %w", err)
 	}
 
-	return manager
+	return nil
 }
 
-// StartServer starts the TCP server
+// StartServer starts the TCP server, which runs until Shutdown is called
 func (m *Manager) StartServer() {
-	listener, err := net.Listen("tcp", ":"+strconv.Itoa(m.me.Port))
+	listener, err := m.transport.Listen(m.me.GetAddress())
 	if err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 	defer listener.Close()
 
+	m.mu.Lock()
+	if m.stopped {
+		m.mu.Unlock()
+		return
+	}
+	m.listener = listener
+	m.mu.Unlock()
+
 	log.Printf("Server listening on port %d", m.me.Port)
 
 	for {
+		// Stop accepting while every connection slot is busy, leaving new
+		// connections in the listen backlog
+		if m.connSlots != nil {
+			select {
+			case m.connSlots <- struct{}{}:
+			case <-m.stop:
+				return
+			}
+		}
+
 		conn, err := listener.Accept()
 		if err != nil {
+			m.releaseConnSlot()
+			if m.isStopped() {
+				return
+			}
 			log.Printf("Failed to accept connection: %v", err)
 			continue
 		}
 
-		go m.handleConnection(conn)
+		if !m.trackConnection() {
+			conn.Close()
+			m.releaseConnSlot()
+			return
+		}
+
+		go func() {
+			defer m.connections.Done()
+			defer m.releaseConnSlot()
+			m.handleConnection(conn)
+		}()
+	}
+}
+
+// Shutdown stops accepting connections and the background tasks, waits for
+// the connections being handled until the context is done and saves the bans
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	if !m.stopped {
+		m.stopped = true
+		close(m.stop)
+	}
+	listener := m.listener
+	m.mu.Unlock()
+
+	if listener != nil {
+		listener.Close()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		m.connections.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = fmt.Errorf("connections still in flight: %w", ctx.Err())
+	}
+
+	if saveErr := m.banManager.Save(); saveErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to save bans: %w", saveErr))
+	}
+	return err
+}
+
+// isStopped checks if Shutdown was called
+func (m *Manager) isStopped() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.stopped
+}
+
+// trackConnection registers a connection to wait for on shutdown, refusing
+// it once shutdown has started
+func (m *Manager) trackConnection() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stopped {
+		return false
+	}
+	m.connections.Add(1)
+	return true
+}
+
+// releaseConnSlot frees a connection slot taken by the accept loop
+func (m *Manager) releaseConnSlot() {
+	if m.connSlots != nil {
+		<-m.connSlots
 	}
 }
 
@@ -84,20 +313,36 @@ func (m *Manager) StartServer() {
 func (m *Manager) handleConnection(conn net.Conn) {
 	defer conn.Close()
 
+	// Drop connections from banned addresses
+	address := remoteHost(conn)
+	if m.banManager.IsBanned(address) {
+		return
+	}
+
+	// Complete the secure handshake and learn who is on the other end
+	peerID, err := authenticate(conn, 10*time.Second)
+	if err != nil {
+		log.Printf("Rejected connection from %s: %v", address, err)
+		return
+	}
+
 	// Set read deadline
 	if err := conn.SetReadDeadline(time.Now().Add(30 * time.Second)); err != nil {
 		return
 	}
 
-	// Read data
-	buffer := make([]byte, 8192)
-	n, err := conn.Read(buffer)
+	// Read exactly one packet, which may span several TCP segments
+	data, err := readPacketData(bufio.NewReader(io.LimitReader(conn, maxRequestSize)))
 	if err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) || errors.Is(err, errMalformedFrame) {
+			m.Misbehaving(address, MisbehaviorMalformedPacket, "malformed packet")
+		}
 		return
 	}
 
 	// Process packet
-	response, err := m.processPacket(buffer[:n])
+	response, err := m.processPacket(address, peerID, data)
 	if err != nil {
 		response = []byte{}
 	}
@@ -115,28 +360,64 @@ func (m *Manager) handleConnection(conn net.Conn) {
 	conn.Write(response)
 }
 
-// processPacket processes an incoming packet and returns a response
-func (m *Manager) processPacket(data []byte) ([]byte, error) {
-	packet, err := FromJSON(data)
+// processPacket processes an incoming packet from the given address and returns
+// a response. Over secure connections, peerID is the authenticated ID of the sender.
+func (m *Manager) processPacket(address, peerID string, data []byte) ([]byte, error) {
+	packet, err := DecodePacket(data)
 	if err != nil {
+		m.Misbehaving(address, MisbehaviorMalformedPacket, "malformed packet")
 		return nil, fmt.Errorf("failed to parse packet: %w", err)
 	}
 
+	if packet.Sender == nil {
+		m.Misbehaving(address, MisbehaviorMalformedPacket, "packet without sender")
+		return nil, fmt.Errorf("packet has no sender")
+	}
+
+	if peerID != "" && packet.Sender.ID != peerID {
+		m.Misbehaving(address, MisbehaviorImpersonation, "sender does not match authenticated identity")
+		return nil, fmt.Errorf("packet sender %s does not match authenticated peer %s", packet.Sender.ID, peerID)
+	}
+
+	// The sender is dialed back at the host the packet came from, never at an
+	// announced one. Its port cannot be checked, but dialing a wrong port
+	// fails authentication against the sender ID.
+	packet.Sender.Host = address
+
+	m.bandwidth.RecordIn(m.trafficKey(peerID, address), packet.Name, len(data))
+
+	// Rate limit per remote host, as peers choose their identity freely
+	if !m.rateLimiter.Allow(address, packet.Name) {
+		m.Misbehaving(address, MisbehaviorRateLimited, "rate limit exceeded")
+		return nil, fmt.Errorf("%w for %s from %s", errRateLimited, packet.Name, address)
+	}
+
+	var response []byte
 	switch packet.Type {
 	case PacketTypeSingle:
-		return m.handleSinglePacket(packet)
+		response, err = m.handleSinglePacket(address, packet)
 	case PacketTypeBroadcast:
-		return m.handleBroadcastPacket(packet)
+		response, err = m.handleBroadcastPacket(address, packet)
 	default:
-		return nil, fmt.Errorf("unknown packet type: %s", packet.Type)
+		err = fmt.Errorf("%w type: %s", errUnknownPacket, packet.Type)
+	}
+
+	if errors.Is(err, errUnknownPacket) {
+		m.Misbehaving(address, MisbehaviorUnknownPacket, err.Error())
 	}
+
+	// Answers count against the upload cap
+	m.bandwidth.WaitUpload(len(response))
+	m.bandwidth.RecordOut(m.trafficKey(peerID, address), packet.Name, len(response))
+
+	return response, err
 }
 
 // handleSinglePacket handles single-target packets
-func (m *Manager) handleSinglePacket(packet *Packet) ([]byte, error) {
+func (m *Manager) handleSinglePacket(address string, packet *Packet) ([]byte, error) {
 	switch packet.Name {
 	case PacketNameJoin:
-		return m.handleJoin(packet)
+		return m.handleJoin(address, packet)
 	case PacketNameJoinAnswer:
 		return m.handleJoinAnswer(packet)
 	case PacketNameGetLatestBlock:
@@ -147,31 +428,60 @@ func (m *Manager) handleSinglePacket(packet *Packet) ([]byte, error) {
 		return m.handleDownloadBlock(packet)
 	case PacketNameDownloadBlockAnswer:
 		return m.handleDownloadBlockAnswer(packet)
+	case PacketNamePing:
+		return m.handlePing(packet)
+	case PacketNamePong:
+		return m.handlePong(packet)
+	case PacketNameGetData:
+		return m.handleGetData(packet)
+	case PacketNameGetDataAnswer:
+		return m.handleGetDataAnswer(packet)
+	case PacketNameNotFound:
+		return m.handleNotFound(packet)
+	case PacketNameGetHeaders:
+		return m.handleGetHeaders(packet)
+	case PacketNameGetHeadersAnswer:
+		return m.handleGetHeadersAnswer(packet)
 	default:
-		return nil, fmt.Errorf("unknown packet name: %s", packet.Name)
+		return nil, fmt.Errorf("%w: %s", errUnknownPacket, packet.Name)
 	}
 }
 
 // handleBroadcastPacket handles broadcast packets
-func (m *Manager) handleBroadcastPacket(packet *Packet) ([]byte, error) {
-	if m.broadcastManager.HasPacket(packet.Index) {
+func (m *Manager) handleBroadcastPacket(address string, packet *Packet) ([]byte, error) {
+	// The message ID is always computed locally: a forged ID could mark the
+	// announcements of future blocks as already seen
+	packet.ID = packet.ComputeID()
+
+	if m.broadcastManager.MarkSeen(packet.ID) {
 		return []byte{}, nil
 	}
 
-	m.broadcastManager.AddPacket(packet.Index)
-
 	switch packet.Name {
+	case PacketNameInv:
+		return m.handleInv(address, packet)
 	case PacketNameFoundBlock:
-		return m.handleFoundBlock(packet)
+		return m.handleFoundBlock(address, packet)
 	default:
 		return []byte{}, nil
 	}
 }
 
-// handleJoin handles a join request
-func (m *Manager) handleJoin(packet *Packet) ([]byte, error) {
-	if !m.HasPeer(packet.Sender) {
-		m.AddPeer(packet.Sender)
+// handleJoin handles a join request from the given address, answering with
+// nothing when no inbound slot is available
+func (m *Manager) handleJoin(address string, packet *Packet) ([]byte, error) {
+	// Peers that predate codec negotiation send an empty request and speak JSON
+	var request joinRequest
+	if err := json.Unmarshal(packet.Content, &request); err != nil {
+		m.Misbehaving(address, MisbehaviorMalformedPacket, "malformed join request")
+		return nil, fmt.Errorf("failed to unmarshal join request: %w", err)
+	}
+	codec := negotiateCodec(request.Codecs, m.supportedCodecs())
+	m.setPeerCodec(packet.Sender, codec)
+
+	if err := m.addInboundPeer(address, packet.Sender); err != nil {
+		log.Printf("Refused join request from %s: %v", address, err)
+		return []byte{}, nil
 	}
 
 	// Update last block index
@@ -179,34 +489,26 @@ func (m *Manager) handleJoin(packet *Packet) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get latest block: %w", err)
 	}
+	m.mu.Lock()
 	m.lastBlockIndex = latestBlock.Index
+	m.mu.Unlock()
 
 	// Send join answer
-	managerData, err := m.ToJSON()
+	answerData, err := json.Marshal(joinAnswer{
+		Me:             m.me,
+		LastBlockIndex: latestBlock.Index,
+		Codec:          codec,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to serialize manager: %w", err)
+		return nil, fmt.Errorf("failed to serialize join answer: %w", err)
 	}
 
-	response := NewPacket(m.me, PacketTypeSingle, PacketNameJoinAnswer, managerData)
-	return response.ToJSON()
+	response := NewPacket(m.me, PacketTypeSingle, PacketNameJoinAnswer, answerData)
+	return packet.Codec().Encode(response)
 }
 
 // handleJoinAnswer handles a join answer
 func (m *Manager) handleJoinAnswer(packet *Packet) ([]byte, error) {
-	var responseData struct {
-		Me             *Peer `json:"me"`
-		LastBlockIndex int   `json:"last_block_index"`
-	}
-	
-	if err := json.Unmarshal(packet.Content, &responseData); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal manager data: %w", err)
-	}
-
-	// Check if we have peers and the response contains valid peer data
-	if len(m.peers) > 0 && responseData.Me != nil {
-		m.UpdatePeer(m.peers[0], responseData.Me)
-	}
-
 	return []byte{}, nil
 }
 
@@ -217,13 +519,13 @@ func (m *Manager) handleGetLatestBlock(packet *Packet) ([]byte, error) {
 		return nil, fmt.Errorf("failed to get latest block: %w", err)
 	}
 
-	blockData, err := json.Marshal(latestBlock)
+	blockData, err := packet.Codec().Marshal(latestBlock)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal block: %w", err)
 	}
 
 	response := NewPacket(m.me, PacketTypeSingle, PacketNameGetLatestBlockAnswer, blockData)
-	return response.ToJSON()
+	return packet.Codec().Encode(response)
 }
 
 // handleGetLatestBlockAnswer handles a get latest block answer
@@ -242,18 +544,23 @@ func (m *Manager) handleDownloadBlock(packet *Packet) ([]byte, error) {
 		return nil, fmt.Errorf("failed to unmarshal download request: %w", err)
 	}
 
+	// Serve large ranges in several requests
+	if request.EndIndex-request.StartIndex >= maxBlocksPerDownload {
+		request.EndIndex = request.StartIndex + maxBlocksPerDownload - 1
+	}
+
 	blocks, err := m.blockchain.GetBlocks(request.StartIndex, request.EndIndex)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get blocks: %w", err)
 	}
 
-	blocksData, err := json.Marshal(blocks)
+	blocksData, err := packet.Codec().Marshal(blocks)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal blocks: %w", err)
 	}
 
 	response := NewPacket(m.me, PacketTypeSingle, PacketNameDownloadBlockAnswer, blocksData)
-	return response.ToJSON()
+	return packet.Codec().Encode(response)
 }
 
 // handleDownloadBlockAnswer handles a download block answer
@@ -261,43 +568,97 @@ func (m *Manager) handleDownloadBlockAnswer(packet *Packet) ([]byte, error) {
 	return []byte{}, nil
 }
 
-// handleFoundBlock handles a found block broadcast
-func (m *Manager) handleFoundBlock(packet *Packet) ([]byte, error) {
+// handleFoundBlock handles a legacy found block broadcast, which announces a block by index only
+func (m *Manager) handleFoundBlock(address string, packet *Packet) ([]byte, error) {
 	blockIndexStr := string(packet.Content)
 	blockIndex, err := strconv.Atoi(blockIndexStr)
-	if err != nil {
+	if err != nil || blockIndex <= 0 {
+		m.Misbehaving(address, MisbehaviorBogusFoundBlock, "bogus found block index")
 		return []byte{}, nil
 	}
 
-	// Check if we already have this block or a newer one
+	// Try to sync chain if we're behind
 	latestBlock, err := m.blockchain.GetLatestBlock()
-	if err == nil && latestBlock.Index >= blockIndex {
-		return []byte{}, nil
+	if err != nil || latestBlock.Index < blockIndex {
+		if err := m.SyncChain(address, packet.Sender, blockIndex); err != nil {
+			log.Printf("Failed to sync chain from %s: %v", packet.Sender.String(), err)
+			return []byte{}, nil
+		}
 	}
 
-	// Try to sync chain if we're behind
-	m.SyncChain(packet.Sender, blockIndex)
+	// Only relay announcements of blocks we hold in our validated chain
+	if m.blockchain.HasBlock(blockIndex) {
+		m.relayBroadcast(packet)
+	}
 
 	return []byte{}, nil
 }
 
+// relayBroadcast forwards a broadcast packet to every peer except the one it
+// came from, as long as it has not reached the hop limit
+func (m *Manager) relayBroadcast(packet *Packet) {
+	if packet.Hops+1 >= m.config.MaxBroadcastHops {
+		return
+	}
+
+	// Relayed packets are sent as coming from us so that receivers sync from a
+	// peer that holds the validated block
+	relayed := *packet
+	relayed.Sender = m.me
+	relayed.Hops = packet.Hops + 1
+
+	relayedData, err := relayed.ToJSON()
+	if err != nil {
+		log.Printf("Failed to serialize relayed packet: %v", err)
+		return
+	}
+
+	m.BroadcastExcept(relayedData, packet.Sender)
+}
+
 // joinNetwork joins an existing network
 func (m *Manager) joinNetwork(initPeer *Peer) error {
-	// Send join request
-	joinData, err := NewPacket(m.me, PacketTypeSingle, PacketNameJoin, []byte("{}")).ToJSON()
+	// Send join request, offering our codecs in order of preference
+	requestData, err := json.Marshal(joinRequest{Codecs: m.supportedCodecs()})
 	if err != nil {
-		return fmt.Errorf("failed to serialize join packet: %w", err)
+		return fmt.Errorf("failed to serialize join request: %w", err)
 	}
 
-	response, err := initPeer.SendTCP(joinData)
+	responsePacket, remoteID, err := m.request(initPeer, NewPacket(m.me, PacketTypeSingle, PacketNameJoin, requestData))
+	if errors.Is(err, errNoAnswer) {
+		return fmt.Errorf("peer refused the join request")
+	}
 	if err != nil {
 		return fmt.Errorf("failed to send join request: %w", err)
 	}
 
-	// Process join answer
-	_, err = m.processPacket(response)
-	if err != nil {
-		return fmt.Errorf("failed to process join answer: %w", err)
+	if responsePacket.Name != PacketNameJoinAnswer {
+		return fmt.Errorf("unexpected answer %s to join request", responsePacket.Name)
+	}
+
+	var responseData joinAnswer
+	if err := responsePacket.Codec().Unmarshal(responsePacket.Content, &responseData); err != nil {
+		return fmt.Errorf("failed to unmarshal join answer: %w", err)
+	}
+
+	if responseData.Me != nil && remoteID != "" && responseData.Me.ID != remoteID {
+		m.Misbehaving(initPeer.Host, MisbehaviorImpersonation, "join answer does not match authenticated identity")
+		return fmt.Errorf("peer announced identity %s but authenticated as %s", responseData.Me.ID, remoteID)
+	}
+	initPeer.advertisedHeight = responseData.LastBlockIndex
+
+	// We reached the peer at the host we dialed, whatever it announces
+	if responseData.Me != nil {
+		responseData.Me.Host = initPeer.Host
+	}
+
+	// Replace the placeholder peer with the identity it announced, speaking the
+	// negotiated codec. Peers that predate negotiation answer without one.
+	if responseData.Me != nil {
+		if _, err := CodecByName(responseData.Codec); err == nil {
+			responseData.Me.codec = responseData.Codec
+		}
+		m.UpdatePeer(initPeer, responseData.Me)
 	}
 
 	return nil
@@ -308,7 +669,12 @@ func (m *Manager) AddPeer(peer *Peer) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if peer == nil || m.banManager.IsBanned(peer.Host) {
+		return
+	}
+
 	if !m.hasPeerInternal(peer) {
+		peer.addedAt = time.Now()
 		m.peers = append(m.peers, peer)
 		m.me.Popularity = len(m.peers)
 	}
@@ -319,13 +685,7 @@ func (m *Manager) RemovePeer(peer *Peer) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	for i, p := range m.peers {
-		if p.IsEqual(peer) {
-			m.peers = append(m.peers[:i], m.peers[i+1:]...)
-			m.me.Popularity = len(m.peers)
-			return
-		}
-	}
+	m.removePeerInternal(peer)
 }
 
 // UpdatePeer updates peer information
@@ -335,6 +695,17 @@ func (m *Manager) UpdatePeer(oldPeer, newPeer *Peer) {
 
 	for i, p := range m.peers {
 		if p.IsEqual(oldPeer) {
+			newPeer.latency = p.latency
+			newPeer.failures = p.failures
+			newPeer.lastSeen = p.lastSeen
+			newPeer.inbound = p.inbound
+			newPeer.address = p.address
+			newPeer.addedAt = p.addedAt
+			newPeer.lastBlock = p.lastBlock
+			newPeer.advertisedHeight = p.advertisedHeight
+			if newPeer.codec == "" {
+				newPeer.codec = p.codec
+			}
 			m.peers[i] = newPeer
 			return
 		}
@@ -381,51 +752,172 @@ func (m *Manager) GetPeerIndex(peer *Peer) int {
 
 // Broadcast sends a message to all peers
 func (m *Manager) Broadcast(data []byte) {
+	m.BroadcastExcept(data, nil)
+}
+
+// BroadcastExcept sends a message to all peers except the one at the address
+// of excluded, re-encoding it in the codec negotiated with each peer
+func (m *Manager) BroadcastExcept(data []byte, excluded *Peer) {
 	m.mu.RLock()
 	peers := make([]*Peer, len(m.peers))
 	copy(peers, m.peers)
 	m.mu.RUnlock()
 
+	// Account the traffic under the name of the broadcast packet
+	var command PacketName
+	packet, err := DecodePacket(data)
+	if err == nil {
+		command = packet.Name
+	}
+	encoded := make(map[string][]byte)
+
 	for _, peer := range peers {
 		if peer == nil {
 			continue
 		}
-		
-		go func(p *Peer) {
-			if _, err := p.SendTCP(data); err != nil {
+
+		if excluded != nil && peer.GetAddress() == excluded.GetAddress() {
+			continue
+		}
+
+		peerData := data
+		if packet != nil {
+			codec := m.codecFor(peer)
+			if _, exists := encoded[codec.Name()]; !exists {
+				if encoded[codec.Name()], err = codec.Encode(packet); err != nil {
+					encoded[codec.Name()] = data
+				}
+			}
+			peerData = encoded[codec.Name()]
+		}
+
+		go func(p *Peer, data []byte) {
+			if _, _, err := m.send(p, command, data); err != nil {
 				log.Printf("Failed to broadcast to peer %s: %v", p.String(), err)
+				m.recordPeerFailure(p)
+				return
+			}
+
+			m.recordPeerSuccess(p, 0)
+		}(peer, peerData)
+	}
+}
+
+// send sends a packet of the given command to a peer, accounting the traffic
+// and waiting for the upload cap, and returns the response with the
+// authenticated peer ID of the remote end
+func (m *Manager) send(peer *Peer, command PacketName, data []byte) ([]byte, string, error) {
+	m.bandwidth.WaitUpload(len(data))
+
+	response, remoteID, err := peer.send(m.transport, data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := m.trafficKey(remoteID, peer.Host)
+	m.bandwidth.RecordOut(key, command, len(data))
+	m.bandwidth.RecordIn(key, command, len(response))
+	return response, remoteID, nil
+}
+
+// request sends a packet to a peer in the codec negotiated with it and decodes
+// the answer, returning it with the authenticated peer ID of the remote end
+func (m *Manager) request(peer *Peer, packet *Packet) (*Packet, string, error) {
+	data, err := m.codecFor(peer).Encode(packet)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to serialize packet: %w", err)
+	}
+
+	response, remoteID, err := m.send(peer, packet.Name, data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(response) == 0 {
+		return nil, remoteID, errNoAnswer
+	}
+
+	answer, err := DecodePacket(response)
+	if err != nil {
+		return nil, remoteID, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return answer, remoteID, nil
+}
+
+// codecFor returns the codec negotiated with a peer, JSON until one is negotiated
+func (m *Manager) codecFor(peer *Peer) Codec {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, p := range m.peers {
+		if p.IsEqual(peer) && p.codec != "" {
+			if codec, err := CodecByName(p.codec); err == nil {
+				return codec
 			}
-		}(peer)
+		}
 	}
+	return JSONCodec{}
 }
 
-// SyncChain synchronizes the blockchain with a peer
-func (m *Manager) SyncChain(peer *Peer, targetIndex int) bool {
+// setPeerCodec records the codec negotiated with a peer, which may not be
+// known yet
+func (m *Manager) setPeerCodec(peer *Peer, codec string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	peer.codec = codec
+	for _, p := range m.peers {
+		if p.IsEqual(peer) {
+			p.codec = codec
+		}
+	}
+}
+
+// supportedCodecs returns the names of the codecs we speak in order of
+// preference, always ending with JSON
+func (m *Manager) supportedCodecs() []string {
+	if m.codec.Name() == CodecJSON {
+		return []string{CodecJSON}
+	}
+	return []string{m.codec.Name(), CodecJSON}
+}
+
+// SyncChain synchronizes the blockchain with a peer, charging invalid blocks
+// to the address that announced them
+func (m *Manager) SyncChain(address string, peer *Peer, targetIndex int) error {
 	if peer == nil {
-		return false
+		return fmt.Errorf("cannot sync from nil peer")
 	}
-	
+
 	latestBlock, err := m.blockchain.GetLatestBlock()
 	if err != nil {
-		return false
+		return fmt.Errorf("failed to get latest block: %w", err)
 	}
 
 	if latestBlock.Index >= targetIndex {
-		return false
+		return nil
 	}
 
 	// Download missing blocks
 	blocks, err := m.DownloadBlocks(peer, latestBlock.Index+1, targetIndex)
 	if err != nil {
-		return false
+		m.Misbehaving(address, MisbehaviorBogusFoundBlock, "announced block could not be downloaded")
+		return fmt.Errorf("failed to download blocks: %w", err)
 	}
 
 	// Add blocks to chain
 	for _, block := range blocks {
-		m.blockchain.AddBlockWithoutVerification(block)
+		if err := m.blockchain.AddBlock(block); err != nil {
+			// Blocks that do not link to our tip may come from a competing
+			// fork, only blocks that are invalid by themselves are penalized
+			if block.IsValid(m.blockchain.GetPoW()) != nil {
+				m.Misbehaving(address, MisbehaviorInvalidBlock, "invalid block")
+			}
+			return fmt.Errorf("cannot add block #%d: %w", block.Index, err)
+		}
 	}
 
-	return true
+	return nil
 }
 
 // DownloadBlocks downloads blocks from a peer
@@ -448,38 +940,40 @@ func (m *Manager) DownloadBlocks(peer *Peer, startIndex, endIndex int) ([]*block
 	}
 
 	packet := NewPacket(m.me, PacketTypeSingle, PacketNameDownloadBlock, requestData)
-	packetData, err := packet.ToJSON()
-	if err != nil {
-		return nil, fmt.Errorf("failed to serialize packet: %w", err)
-	}
-
-	response, err := peer.SendTCP(packetData)
+	responsePacket, _, err := m.request(peer, packet)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send download request: %w", err)
 	}
 
-	responsePacket, err := FromJSON(response)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
-	}
-
 	var blocks []*blockchain.Block
-	if err := json.Unmarshal(responsePacket.Content, &blocks); err != nil {
+	if err := responsePacket.Codec().Unmarshal(responsePacket.Content, &blocks); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal blocks: %w", err)
 	}
 
 	return blocks, nil
 }
 
+// joinRequest is the content of a JOIN packet
+type joinRequest struct {
+	// Codecs lists the wire codecs of the joining peer in order of preference
+	Codecs []string `json:"codecs,omitempty"`
+}
+
+// joinAnswer is the content of a JOINANSWER packet
+type joinAnswer struct {
+	Me             *Peer  `json:"me"`
+	LastBlockIndex int    `json:"last_block_index"`
+	Codec          string `json:"codec,omitempty"`
+}
+
 // ToJSON serializes the manager to JSON
 func (m *Manager) ToJSON() ([]byte, error) {
-	managerData := struct {
-		Me             *Peer `json:"me"`
-		LastBlockIndex int   `json:"last_block_index"`
-	}{
+	m.mu.RLock()
+	managerData := joinAnswer{
 		Me:             m.me,
 		LastBlockIndex: m.lastBlockIndex,
 	}
+	m.mu.RUnlock()
 
 	return json.Marshal(managerData)
 }
@@ -489,42 +983,120 @@ func (m *Manager) GetMe() *Peer {
 	return m.me
 }
 
+// GetBroadcastStats returns the broadcast deduplication metrics
+func (m *Manager) GetBroadcastStats() BroadcastStats {
+	return m.broadcastManager.Stats()
+}
+
+// GetBandwidthStats returns the traffic counters per peer and per command
+func (m *Manager) GetBandwidthStats() BandwidthStats {
+	return m.bandwidth.Stats()
+}
+
+// GetBanManager returns the ban manager
+func (m *Manager) GetBanManager() *BanManager {
+	return m.banManager
+}
+
+// GetIdentity returns the identity of the node
+func (m *Manager) GetIdentity() *Identity {
+	return m.identity
+}
+
 // GetBlockchain returns the blockchain instance
 func (m *Manager) GetBlockchain() *blockchain.Blockchain {
 	return m.blockchain
 }
 
-// SyncFullChainFromPeer synchronizes the entire blockchain from a peer
-func (m *Manager) SyncFullChainFromPeer(peer *Peer) error {
-	// Get latest block from peer
-	latestBlockData, err := NewPacket(m.me, PacketTypeSingle, PacketNameGetLatestBlock, nil).ToJSON()
-	if err != nil {
-		return fmt.Errorf("failed to serialize latest block request: %w", err)
+// Misbehaving records a protocol violation from an address and disconnects
+// every peer at that address once it gets banned
+func (m *Manager) Misbehaving(address string, score int, reason string) {
+	if address == "" {
+		return
 	}
 
-	latestBlockResponse, err := peer.SendTCP(latestBlockData)
-	if err != nil {
-		return fmt.Errorf("failed to get latest block: %w", err)
+	log.Printf("Peer %s misbehaving (+%d): %s", address, score, reason)
+	if !m.banManager.Misbehaving(address, score, reason) {
+		return
 	}
 
-	responsePacket, err := FromJSON(latestBlockResponse)
-	if err != nil {
-		return fmt.Errorf("failed to parse latest block response: %w", err)
+	log.Printf("Banned peer %s: %s", address, reason)
+	m.RemovePeersByHost(address)
+}
+
+// BanPeer bans an address for the default duration and disconnects its peers
+func (m *Manager) BanPeer(address, reason string) {
+	if err := m.banManager.Ban(address, 0, reason); err != nil {
+		log.Printf("Failed to ban peer %s: %v", address, err)
+	} else {
+		log.Printf("Banned peer %s: %s", address, reason)
 	}
 
-	var block blockchain.Block
-	if err := json.Unmarshal(responsePacket.Content, &block); err != nil {
-		return fmt.Errorf("failed to unmarshal latest block: %w", err)
+	m.RemovePeersByHost(address)
+}
+
+// RemovePeersByHost removes every peer with the given host
+func (m *Manager) RemovePeersByHost(host string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	peers := m.peers[:0]
+	removed := make([]*Peer, 0)
+	for _, p := range m.peers {
+		if p.Host != host && p.address != host {
+			peers = append(peers, p)
+		} else {
+			removed = append(removed, p)
+		}
 	}
+	m.peers = peers
+	m.me.Popularity = len(m.peers)
 
-	// Download all blocks
-	blocks, err := m.DownloadBlocks(peer, 0, block.Index)
-	if err != nil {
-		return fmt.Errorf("failed to download blocks: %w", err)
+	for _, p := range removed {
+		m.forgetTraffic(p)
 	}
+}
 
-	// Replace the entire chain
-	m.blockchain.ReplaceChain(blocks)
+// authorizeMember checks that a node key belongs to the current membership of
+// a permissioned chain
+func authorizeMember(bc *blockchain.Blockchain, publicKey ed25519.PublicKey) error {
+	membership := bc.GetMembership()
+	if membership == nil || membership.IsMember(blockchain.EncodePublicKey(publicKey)) {
+		return nil
+	}
 
-	return nil
+	return fmt.Errorf("node %s is not a member of the network", PeerIDFromPublicKey(publicKey))
+}
+
+// peerKey identifies a peer by its authenticated ID, or by its address over
+// plaintext connections
+func peerKey(peerID, address string) string {
+	if peerID != "" {
+		return peerID
+	}
+	return address
+}
+
+// trafficKey returns the key under which the traffic of a connected peer is
+// counted, empty for senders that are not peers, whose traffic only counts in
+// the totals
+func (m *Manager) trafficKey(peerID, host string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, p := range m.peers {
+		if (peerID != "" && p.ID == peerID) || (peerID == "" && (p.Host == host || p.address == host)) {
+			return peerKey(peerID, host)
+		}
+	}
+	return ""
+}
+
+// remoteHost returns the host part of a connection's remote address
+func remoteHost(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
 }
@@ -1,6 +1,8 @@
 package network
 
 import (
+	"crypto/sha512"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 )
@@ -24,15 +26,52 @@ const (
 	PacketNameDownloadBlock        PacketName = "DOWNLOADBLOCK"
 	PacketNameDownloadBlockAnswer  PacketName = "DOWNLOADBLOCKANSWER"
 	PacketNameFoundBlock           PacketName = "FOUNDBLOCK"
+	PacketNamePing                 PacketName = "PING"
+	PacketNamePong                 PacketName = "PONG"
+	PacketNameInv                  PacketName = "INV"
+	PacketNameGetData              PacketName = "GETDATA"
+	PacketNameGetDataAnswer        PacketName = "GETDATAANSWER"
+	PacketNameNotFound             PacketName = "NOTFOUND"
+	PacketNameGetHeaders           PacketName = "GETHEADERS"
+	PacketNameGetHeadersAnswer     PacketName = "GETHEADERSANSWER"
 )
 
+// packetNames holds the packet names of the protocol
+var packetNames = map[PacketName]bool{
+	PacketNameJoin:                 true,
+	PacketNameJoinAnswer:           true,
+	PacketNameGetLatestBlock:       true,
+	PacketNameGetLatestBlockAnswer: true,
+	PacketNameDownloadBlock:        true,
+	PacketNameDownloadBlockAnswer:  true,
+	PacketNameFoundBlock:           true,
+	PacketNamePing:                 true,
+	PacketNamePong:                 true,
+	PacketNameInv:                  true,
+	PacketNameGetData:              true,
+	PacketNameGetDataAnswer:        true,
+	PacketNameNotFound:             true,
+	PacketNameGetHeaders:           true,
+	PacketNameGetHeadersAnswer:     true,
+}
+
+// isKnown checks if the name is a packet name of the protocol
+func (n PacketName) isKnown() bool {
+	return packetNames[n]
+}
+
 // Packet represents a network packet for communication between peers
 type Packet struct {
+	ID      string     `json:"id,omitempty"`
 	Sender  *Peer      `json:"sender"`
 	Type    PacketType `json:"type"`
 	Name    PacketName `json:"name"`
 	Content []byte     `json:"content"`
 	Index   int        `json:"index"`
+	Hops    int        `json:"hops"`
+
+	// codec is the codec the packet was decoded with
+	codec Codec
 }
 
 // NewPacket creates a new packet instance
@@ -48,13 +87,25 @@ func NewPacket(sender *Peer, packetType PacketType, name PacketName, content []b
 
 // NewBroadcastPacket creates a new broadcast packet
 func NewBroadcastPacket(sender *Peer, name PacketName, content []byte, index int) *Packet {
-	return &Packet{
+	packet := &Packet{
 		Sender:  sender,
 		Type:    PacketTypeBroadcast,
 		Name:    name,
 		Content: content,
 		Index:   index,
 	}
+	packet.ID = packet.ComputeID()
+	return packet
+}
+
+// ComputeID computes the message ID of a broadcast packet from its name, index
+// and content, which identify the announced object. The sender is left out
+// because relays replace it, so that every copy of a packet has the same ID.
+func (p *Packet) ComputeID() string {
+	hasher := sha512.New()
+	fmt.Fprintf(hasher, "%s|%d|", p.Name, p.Index)
+	hasher.Write(p.Content)
+	return base64.URLEncoding.EncodeToString(hasher.Sum(nil))
 }
 
 // ToJSON serializes the packet to JSON
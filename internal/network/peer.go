@@ -1,20 +1,55 @@
 package network
 
 import (
-	"crypto/sha512"
-	"encoding/base64"
 	"fmt"
 	"io"
 	"net"
+	"strconv"
 	"time"
 )
 
+// maxResponseSize is the maximum size of a response read from a peer
+const maxResponseSize = 32 * 1024 * 1024
+
+// unknownPeerID is the ID of a peer known only by its address
+const unknownPeerID = "0"
+
 // Peer represents a network peer in the blockchain network
 type Peer struct {
 	ID         string `json:"id"`
 	Popularity int    `json:"popularity"`
 	Host       string `json:"host"`
 	Port       int    `json:"port"`
+
+	// Liveness information, maintained locally by the manager
+	latency  time.Duration
+	failures int
+	lastSeen time.Time
+
+	// Slot information, maintained locally by the manager
+	inbound   bool
+	address   string
+	addedAt   time.Time
+	lastBlock time.Time
+
+	// codec is the name of the wire codec negotiated with the peer
+	codec string
+
+	// advertisedHeight is the index of the latest block of the peer when we joined it
+	advertisedHeight int
+}
+
+// PeerInfo is a snapshot of a peer and its liveness information
+type PeerInfo struct {
+	ID         string        `json:"id"`
+	Popularity int           `json:"popularity"`
+	Host       string        `json:"host"`
+	Port       int           `json:"port"`
+	Latency    time.Duration `json:"latency"`
+	Failures   int           `json:"failures"`
+	LastSeen   time.Time     `json:"last_seen"`
+	Inbound    bool          `json:"inbound"`
+	LastBlock  time.Time     `json:"last_block"`
 }
 
 // NewPeer creates a new peer instance
@@ -27,14 +62,19 @@ func NewPeer(id string, popularity int, host string, port int) *Peer {
 	}
 }
 
-// GeneratePeerID generates a unique peer ID
-func GeneratePeerID() string {
-	timestamp := time.Now().UnixNano()
-	data := fmt.Sprintf("%d", timestamp)
+// NewPeerFromAddress creates a peer with an unknown ID from a host:port address
+func NewPeerFromAddress(address string) (*Peer, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer address %s: %w", address, err)
+	}
 
-	hasher := sha512.New()
-	hasher.Write([]byte(data))
-	return base64.URLEncoding.EncodeToString(hasher.Sum(nil))[:16]
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer port in %s: %w", address, err)
+	}
+
+	return NewPeer(unknownPeerID, 0, host, port), nil
 }
 
 // GetAddress returns the full address of the peer
@@ -44,39 +84,69 @@ func (p *Peer) GetAddress() string {
 
 // SendTCP sends data to the peer via TCP and returns the response
 func (p *Peer) SendTCP(data []byte) ([]byte, error) {
-	conn, err := net.DialTimeout("tcp", p.GetAddress(), 30*time.Second)
+	return p.Send(TCPTransport{}, data)
+}
+
+// Send sends data to the peer through a transport and returns the response
+func (p *Peer) Send(transport Transport, data []byte) ([]byte, error) {
+	response, _, err := p.send(transport, data)
+	return response, err
+}
+
+// send sends data to the peer and returns the response along with the
+// authenticated peer ID of the remote end, empty over plaintext transports
+func (p *Peer) send(transport Transport, data []byte) ([]byte, string, error) {
+	conn, err := transport.Dial(p.GetAddress(), 30*time.Second)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to peer %s: %w", p.GetAddress(), err)
+		return nil, "", fmt.Errorf("failed to connect to peer %s: %w", p.GetAddress(), err)
 	}
 	defer conn.Close()
 
+	// Make sure we talk to the expected node before sending anything
+	remoteID, err := authenticate(conn, 10*time.Second)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to authenticate peer %s: %w", p.GetAddress(), err)
+	}
+
+	if remoteID != "" && p.ID != unknownPeerID && p.ID != remoteID {
+		return nil, "", fmt.Errorf("peer %s presented identity %s instead of %s", p.GetAddress(), remoteID, p.ID)
+	}
+
 	// Set write deadline
 	if err := conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
-		return nil, fmt.Errorf("failed to set write deadline: %w", err)
+		return nil, "", fmt.Errorf("failed to set write deadline: %w", err)
 	}
 
 	// Send data
 	if _, err := conn.Write(data); err != nil {
-		return nil, fmt.Errorf("failed to send data to peer: %w", err)
+		return nil, "", fmt.Errorf("failed to send data to peer: %w", err)
 	}
 
 	// Set read deadline
 	if err := conn.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
-		return nil, fmt.Errorf("failed to set read deadline: %w", err)
+		return nil, "", fmt.Errorf("failed to set read deadline: %w", err)
 	}
 
-	// Read response
-	buffer := make([]byte, 8192)
-	n, err := conn.Read(buffer)
+	// Read response until the peer closes the connection
+	response, err := io.ReadAll(io.LimitReader(conn, maxResponseSize))
 	if err != nil {
-		if err == io.EOF {
-			return nil, nil
-		}
-		
-		return nil, fmt.Errorf("failed to read response from peer: %w", err)
+		return nil, "", fmt.Errorf("failed to read response from peer: %w", err)
+	}
+
+	if len(response) == 0 {
+		return nil, remoteID, nil
 	}
 
-	return buffer[:n], nil
+	return response, remoteID, nil
+}
+
+// netAddress returns the address the peer connected from for inbound peers,
+// or its announced host otherwise
+func (p *Peer) netAddress() string {
+	if p.address != "" {
+		return p.address
+	}
+	return p.Host
 }
 
 // IsEqual checks if two peers are the same
@@ -0,0 +1,139 @@
+package network
+
+import (
+	"blockchain-go/internal/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiterIdleTimeout is how long the buckets of an idle peer are kept
+const rateLimiterIdleTimeout = 10 * time.Minute
+
+// tokenBucket is a token bucket refilled at a constant rate up to its burst size
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full token bucket
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// refill adds the tokens accumulated since the last refill
+func (tb *tokenBucket) refill(now time.Time) {
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+}
+
+// allow takes n tokens if they are available
+func (tb *tokenBucket) allow(n float64) bool {
+	tb.refill(time.Now())
+
+	if tb.tokens < n {
+		return false
+	}
+	tb.tokens -= n
+	return true
+}
+
+// reserve takes n tokens, going into debt if needed, and returns how long to
+// wait until the debt is paid off
+func (tb *tokenBucket) reserve(n float64) time.Duration {
+	tb.refill(time.Now())
+
+	tb.tokens -= n
+	if tb.tokens >= 0 || tb.rate <= 0 {
+		return 0
+	}
+	return time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+}
+
+// RateLimiter limits the messages accepted from each peer with one token
+// bucket for all its messages and one per limited message type
+type RateLimiter struct {
+	mu            sync.Mutex
+	peerLimit     config.RateLimitConfig
+	messageLimits map[string]config.RateLimitConfig
+	buckets       map[string]*tokenBucket
+	lastCleanup   time.Time
+}
+
+// NewRateLimiter creates a rate limiter. A limit with a rate of zero or less
+// disables limiting; message types are matched case-insensitively.
+func NewRateLimiter(peerLimit config.RateLimitConfig, messageLimits map[string]config.RateLimitConfig) *RateLimiter {
+	limits := make(map[string]config.RateLimitConfig, len(messageLimits))
+	for name, limit := range messageLimits {
+		limits[strings.ToUpper(name)] = limit
+	}
+
+	return &RateLimiter{
+		peerLimit:     peerLimit,
+		messageLimits: limits,
+		buckets:       make(map[string]*tokenBucket),
+		lastCleanup:   time.Now(),
+	}
+}
+
+// Allow checks if a peer may send another message of the given type
+func (rl *RateLimiter) Allow(peer string, name PacketName) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.cleanup()
+
+	if !rl.take(peer, rl.peerLimit) {
+		return false
+	}
+
+	if limit, exists := rl.messageLimits[string(name)]; exists {
+		return rl.take(peer+"|"+string(name), limit)
+	}
+
+	return true
+}
+
+// take takes a token from the bucket of a key (internal use, no locking)
+func (rl *RateLimiter) take(key string, limit config.RateLimitConfig) bool {
+	if limit.Rate <= 0 {
+		return true
+	}
+
+	bucket, exists := rl.buckets[key]
+	if !exists {
+		bucket = newTokenBucket(limit.Rate, limit.Burst)
+		rl.buckets[key] = bucket
+	}
+
+	return bucket.allow(1)
+}
+
+// cleanup forgets the buckets of idle peers (internal use, no locking)
+func (rl *RateLimiter) cleanup() {
+	now := time.Now()
+	if now.Sub(rl.lastCleanup) < rateLimiterIdleTimeout {
+		return
+	}
+	rl.lastCleanup = now
+
+	for key, bucket := range rl.buckets {
+		if now.Sub(bucket.last) > rateLimiterIdleTimeout {
+			delete(rl.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package network
+
+import (
+	"blockchain-go/internal/config"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	rl := NewRateLimiter(config.RateLimitConfig{Rate: 0.001, Burst: 3},
+		map[string]config.RateLimitConfig{"ping": {Rate: 0.001, Burst: 1}})
+
+	if !rl.Allow("10.0.0.1", PacketNamePing) {
+		t.Fatal("first ping rejected")
+	}
+	if rl.Allow("10.0.0.1", PacketNamePing) {
+		t.Fatal("ping beyond its message burst accepted")
+	}
+	if !rl.Allow("10.0.0.1", PacketNameGetHeaders) {
+		t.Fatal("message without limit rejected within the peer burst")
+	}
+	if rl.Allow("10.0.0.1", PacketNameGetHeaders) {
+		t.Fatal("message beyond the peer burst accepted")
+	}
+
+	if !rl.Allow("10.0.0.2", PacketNamePing) {
+		t.Fatal("ping of another peer rejected")
+	}
+}
+
+func TestRateLimitFreshIdentities(t *testing.T) {
+	const (
+		burst      = 10
+		identities = 200
+		address    = "10.0.0.1"
+	)
+
+	m := newSlotsManager(32)
+	m.rateLimiter = NewRateLimiter(config.RateLimitConfig{Rate: 0.001, Burst: burst}, nil)
+
+	// Every packet comes from a new authenticated identity of the same host
+	accepted := 0
+	for i := 0; i < identities; i++ {
+		id := fmt.Sprintf("fresh-identity-%d", i)
+		data, err := JSONCodec{}.Encode(NewPacket(NewPeer(id, 0, address, testPort), PacketTypeSingle, PacketNamePing, nil))
+		if err != nil {
+			t.Fatalf("failed to encode ping: %v", err)
+		}
+
+		_, err = m.processPacket(address, id, data)
+		switch {
+		case err == nil:
+			accepted++
+		case !errors.Is(err, errRateLimited):
+			t.Fatalf("ping %d failed: %v", i, err)
+		}
+	}
+
+	if accepted != burst {
+		t.Fatalf("accepted %d pings from fresh identities, want the burst of %d", accepted, burst)
+	}
+
+	m.rateLimiter.mu.Lock()
+	buckets := len(m.rateLimiter.buckets)
+	m.rateLimiter.mu.Unlock()
+	if buckets != 1 {
+		t.Fatalf("rate limiter holds %d buckets, want 1", buckets)
+	}
+
+	// Senders that never joined only count in the totals
+	stats := m.GetBandwidthStats()
+	if len(stats.Peers) != 0 {
+		t.Fatalf("bandwidth meter holds %d peers, want none", len(stats.Peers))
+	}
+	if stats.Total.MessagesIn != identities {
+		t.Fatalf("counted %d messages in, want %d", stats.Total.MessagesIn, identities)
+	}
+}
+
+func TestBandwidthCountsConnectedPeers(t *testing.T) {
+	m := newSlotsManager(32)
+	peer := addInbound(t, m, "10.0.0.1")[0]
+
+	for _, sender := range []*Peer{peer, NewPeer("stranger", 0, "10.0.0.2", testPort)} {
+		data, err := JSONCodec{}.Encode(NewPacket(sender, PacketTypeSingle, PacketNamePing, nil))
+		if err != nil {
+			t.Fatalf("failed to encode ping: %v", err)
+		}
+		if _, err := m.processPacket(sender.Host, sender.ID, data); err != nil {
+			t.Fatalf("ping from %s failed: %v", sender.Host, err)
+		}
+	}
+
+	stats := m.GetBandwidthStats()
+	if len(stats.Peers) != 1 || stats.Peers[peer.ID].MessagesIn != 1 {
+		t.Fatalf("peer counters %+v, want one message from %s only", stats.Peers, peer.ID)
+	}
+
+	m.RemovePeer(peer)
+	if stats := m.GetBandwidthStats(); len(stats.Peers) != 0 {
+		t.Fatalf("counters of a removed peer kept: %+v", stats.Peers)
+	}
+}
@@ -0,0 +1,272 @@
+package network
+
+import (
+	"blockchain-go/internal/blockchain"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// DownloadProgress reports the progress of a block download
+type DownloadProgress struct {
+	Downloaded int `json:"downloaded"`
+	Total      int `json:"total"`
+	InFlight   int `json:"in_flight"`
+}
+
+// downloadWindow is a range of consecutive headers downloaded in a single request
+type downloadWindow struct {
+	index    int
+	headers  []*blockchain.BlockHeader
+	peer     *Peer
+	attempt  int
+	started  time.Time
+	excluded map[string]bool
+}
+
+// downloadResult is the outcome of a window download attempt
+type downloadResult struct {
+	window  *downloadWindow
+	peer    *Peer
+	attempt int
+	blocks  []*blockchain.Block
+	err     error
+}
+
+// DownloadScheduler downloads the blocks of a header chain in windows,
+// concurrently from every peer sharing the chain, and feeds them in order
+type DownloadScheduler struct {
+	mu           sync.RWMutex
+	manager      *Manager
+	headers      []*blockchain.BlockHeader
+	sources      []*HeaderChain
+	windowSize   int
+	stallTimeout time.Duration
+	feed         func(*Peer, []*blockchain.Block) error
+	done         chan struct{}
+	downloaded   int
+	inFlight     int
+}
+
+// NewDownloadScheduler creates a download scheduler for headers. Blocks are
+// fetched from the peers of the chains containing them and passed to feed
+// in chain order, along with the peer that served them.
+func NewDownloadScheduler(m *Manager, headers []*blockchain.BlockHeader, sources []*HeaderChain, feed func(*Peer, []*blockchain.Block) error) *DownloadScheduler {
+	stallTimeout := time.Duration(m.config.DownloadStallTimeout) * time.Second
+	if stallTimeout <= 0 {
+		stallTimeout = 15 * time.Second
+	}
+
+	return &DownloadScheduler{
+		manager:      m,
+		headers:      headers,
+		sources:      sources,
+		windowSize:   m.downloadWindowSize(),
+		stallTimeout: stallTimeout,
+		feed:         feed,
+	}
+}
+
+// Progress returns the current download progress
+func (ds *DownloadScheduler) Progress() DownloadProgress {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	return DownloadProgress{
+		Downloaded: ds.downloaded,
+		Total:      len(ds.headers),
+		InFlight:   ds.inFlight,
+	}
+}
+
+// Run downloads every window and returns once all blocks were fed in order
+func (ds *DownloadScheduler) Run() error {
+	windows := ds.splitWindows()
+	if len(windows) == 0 {
+		return nil
+	}
+
+	// Stop late downloads from blocking once the run is over
+	ds.done = make(chan struct{})
+	defer close(ds.done)
+
+	pending := make([]*downloadWindow, len(windows))
+	copy(pending, windows)
+
+	// Peers stay busy until their request returns, even after it stalled
+	busy := make(map[string]*downloadWindow)
+	stalled := make(map[string]bool)
+	completed := make(map[int]downloadResult)
+	results := make(chan downloadResult, len(windows))
+	nextWindow := 0
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for nextWindow < len(windows) {
+		// Assign pending windows to idle peers holding them
+		remaining := pending[:0]
+		for _, window := range pending {
+			peer := ds.selectPeer(window, busy)
+			if peer == nil {
+				if !ds.hasEligiblePeer(window) {
+					return fmt.Errorf("no peer left to download blocks #%d to #%d",
+						window.headers[0].Index, window.headers[len(window.headers)-1].Index)
+				}
+				remaining = append(remaining, window)
+				continue
+			}
+
+			ds.start(window, peer, busy, results)
+		}
+		pending = remaining
+
+		select {
+		case result := <-results:
+			window := result.window
+			address := result.peer.GetAddress()
+			delete(busy, address)
+			delete(stalled, address)
+			ds.setInFlight(len(busy))
+
+			if result.attempt != window.attempt {
+				// Late answer of a stalled attempt already rescheduled
+				continue
+			}
+
+			if result.err != nil {
+				log.Printf("Failed to download window #%d from %s: %v", window.index, window.peer.String(), result.err)
+				window.excluded[window.peer.GetAddress()] = true
+				window.peer = nil
+				pending = append(pending, window)
+				continue
+			}
+
+			completed[window.index] = result
+
+			// Feed completed windows in chain order
+			for nextWindow < len(windows) {
+				ready, exists := completed[nextWindow]
+				if !exists {
+					break
+				}
+
+				if err := ds.feed(ready.window.peer, ready.blocks); err != nil {
+					return fmt.Errorf("failed to process window #%d: %w", nextWindow, err)
+				}
+
+				delete(completed, nextWindow)
+				nextWindow++
+				ds.reportProgress(len(ready.blocks))
+			}
+
+		case <-ticker.C:
+			// Reschedule stalled windows on other peers
+			for address, window := range busy {
+				if stalled[address] || time.Since(window.started) < ds.stallTimeout {
+					continue
+				}
+
+				log.Printf("Download of window #%d from %s stalled, rescheduling", window.index, window.peer.String())
+				stalled[address] = true
+				window.excluded[address] = true
+				window.peer = nil
+				window.attempt++
+				pending = append(pending, window)
+			}
+		}
+	}
+
+	return nil
+}
+
+// splitWindows splits the headers into download windows
+func (ds *DownloadScheduler) splitWindows() []*downloadWindow {
+	windows := make([]*downloadWindow, 0, len(ds.headers)/ds.windowSize+1)
+
+	for start := 0; start < len(ds.headers); start += ds.windowSize {
+		end := start + ds.windowSize
+		if end > len(ds.headers) {
+			end = len(ds.headers)
+		}
+
+		windows = append(windows, &downloadWindow{
+			index:    len(windows),
+			headers:  ds.headers[start:end],
+			excluded: make(map[string]bool),
+		})
+	}
+
+	return windows
+}
+
+// selectPeer returns an idle peer that holds the window and was not excluded for it
+func (ds *DownloadScheduler) selectPeer(window *downloadWindow, busy map[string]*downloadWindow) *Peer {
+	lastHeader := window.headers[len(window.headers)-1]
+
+	for _, source := range ds.sources {
+		address := source.Peer.GetAddress()
+		if busy[address] != nil || window.excluded[address] || !source.HasHeader(lastHeader) {
+			continue
+		}
+
+		if ds.manager.banManager.IsBanned(source.Peer.Host) {
+			continue
+		}
+
+		return source.Peer
+	}
+
+	return nil
+}
+
+// hasEligiblePeer checks if any peer, busy or not, can still serve the window
+func (ds *DownloadScheduler) hasEligiblePeer(window *downloadWindow) bool {
+	lastHeader := window.headers[len(window.headers)-1]
+
+	for _, source := range ds.sources {
+		if !window.excluded[source.Peer.GetAddress()] && source.HasHeader(lastHeader) &&
+			!ds.manager.banManager.IsBanned(source.Peer.Host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// start downloads a window from a peer in the background
+func (ds *DownloadScheduler) start(window *downloadWindow, peer *Peer, busy map[string]*downloadWindow, results chan<- downloadResult) {
+	window.peer = peer
+	window.started = time.Now()
+	window.attempt++
+	busy[peer.GetAddress()] = window
+	ds.setInFlight(len(busy))
+
+	attempt := window.attempt
+	go func() {
+		blocks, err := ds.manager.downloadBodyBatch(peer.Host, peer, window.headers)
+		select {
+		case results <- downloadResult{window: window, peer: peer, attempt: attempt, blocks: blocks, err: err}:
+		case <-ds.done:
+		}
+	}()
+}
+
+// setInFlight updates the number of windows being downloaded
+func (ds *DownloadScheduler) setInFlight(inFlight int) {
+	ds.mu.Lock()
+	ds.inFlight = inFlight
+	ds.mu.Unlock()
+}
+
+// reportProgress records fed blocks and logs the download progress
+func (ds *DownloadScheduler) reportProgress(blocks int) {
+	ds.mu.Lock()
+	ds.downloaded += blocks
+	downloaded := ds.downloaded
+	ds.mu.Unlock()
+
+	total := len(ds.headers)
+	log.Printf("Downloaded %d/%d blocks (%.1f%%)", downloaded, total, float64(downloaded)*100/float64(total))
+}
@@ -0,0 +1,206 @@
+package network
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"time"
+)
+
+// evictionProtection is how long a peer that delivered a new block is
+// protected from inbound eviction
+const evictionProtection = 10 * time.Minute
+
+// addInboundPeer adds a peer that joined us from the given remote address,
+// enforcing the per-IP, per-subnet and inbound limits. When the inbound slots
+// are full, the least useful inbound peer is evicted to make room.
+func (m *Manager) addInboundPeer(address string, peer *Peer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if peer == nil || m.banManager.IsBanned(address) {
+		return fmt.Errorf("peer not allowed")
+	}
+
+	if m.hasPeerInternal(peer) {
+		return nil
+	}
+
+	if !isLoopback(address) {
+		if limit := m.config.MaxPeersPerIP; limit > 0 && m.countPeers(address, hostKey) >= limit {
+			return fmt.Errorf("too many peers from %s", address)
+		}
+
+		if limit := m.config.MaxPeersPerSubnet; limit > 0 && m.countPeers(address, subnetKey) >= limit {
+			return fmt.Errorf("too many peers from subnet %s", subnetKey(address))
+		}
+	}
+
+	if limit := m.config.MaxInboundPeers; limit > 0 && m.countInbound() >= limit {
+		victim := m.selectEvictionCandidate()
+		if victim == nil {
+			return fmt.Errorf("inbound peer slots are full")
+		}
+
+		m.removePeerInternal(victim)
+		log.Printf("Evicted inbound peer %s to make room for %s", victim.String(), peer.String())
+	}
+
+	peer.inbound = true
+	peer.address = address
+	peer.addedAt = time.Now()
+	m.peers = append(m.peers, peer)
+	m.me.Popularity = len(m.peers)
+	return nil
+}
+
+// HasOutboundSlot checks if another outbound peer can be added
+func (m *Manager) HasOutboundSlot() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	limit := m.config.MaxOutboundPeers
+	return limit <= 0 || len(m.peers)-m.countInbound() < limit
+}
+
+// selectEvictionCandidate returns the least useful inbound peer, or nil if
+// every inbound peer is protected (internal use, no locking). Peers from the
+// most crowded subnet go first, then the ones with the most failures, the
+// oldest block delivery, the highest latency and the most recent connection.
+func (m *Manager) selectEvictionCandidate() *Peer {
+	candidates := make([]*Peer, 0)
+	for _, p := range m.peers {
+		if p.inbound && time.Since(p.lastBlock) > evictionProtection {
+			candidates = append(candidates, p)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	crowd := make(map[string]int)
+	for _, p := range candidates {
+		crowd[subnetKey(p.netAddress())]++
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if ca, cb := crowd[subnetKey(a.netAddress())], crowd[subnetKey(b.netAddress())]; ca != cb {
+			return ca > cb
+		}
+		if a.failures != b.failures {
+			return a.failures > b.failures
+		}
+		if !a.lastBlock.Equal(b.lastBlock) {
+			return a.lastBlock.Before(b.lastBlock)
+		}
+		if a.latency != b.latency {
+			return a.latency > b.latency
+		}
+		return a.addedAt.After(b.addedAt)
+	})
+
+	return candidates[0]
+}
+
+// recordPeerBlock marks a peer as having delivered a new block
+func (m *Manager) recordPeerBlock(peer *Peer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range m.peers {
+		if p.IsEqual(peer) {
+			p.lastBlock = time.Now()
+			return
+		}
+	}
+}
+
+// countInbound returns the number of inbound peers (internal use, no locking)
+func (m *Manager) countInbound() int {
+	count := 0
+	for _, p := range m.peers {
+		if p.inbound {
+			count++
+		}
+	}
+	return count
+}
+
+// countPeers returns the number of peers sharing the key of an address (internal use, no locking)
+func (m *Manager) countPeers(address string, key func(string) string) int {
+	count := 0
+	for _, p := range m.peers {
+		if key(p.netAddress()) == key(address) {
+			count++
+		}
+	}
+	return count
+}
+
+// removePeerInternal removes a peer (internal use, no locking)
+func (m *Manager) removePeerInternal(peer *Peer) {
+	for i, p := range m.peers {
+		if p.IsEqual(peer) {
+			m.peers = append(m.peers[:i], m.peers[i+1:]...)
+			m.me.Popularity = len(m.peers)
+			m.forgetTraffic(p)
+			return
+		}
+	}
+}
+
+// forgetTraffic drops the traffic counters of a removed peer, unless a
+// remaining peer is counted under the same key (internal use, requires the lock)
+func (m *Manager) forgetTraffic(removed *Peer) {
+	// Traffic is counted by peer ID, or by host without authentication
+	for _, key := range []string{removed.ID, removed.Host, removed.address} {
+		if key == "" || key == unknownPeerID {
+			continue
+		}
+
+		shared := false
+		for _, p := range m.peers {
+			if p.ID == key || p.Host == key || p.address == key {
+				shared = true
+				break
+			}
+		}
+
+		if !shared {
+			m.bandwidth.Forget(key)
+		}
+	}
+}
+
+// hostKey groups addresses by host
+func hostKey(address string) string {
+	return address
+}
+
+// subnetKey groups addresses by /24 IPv4 or /48 IPv6 subnet. Hosts that are
+// not IP addresses form their own group.
+func subnetKey(address string) string {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return address
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String() + "/48"
+}
+
+// isLoopback checks if an address is a loopback address, exempt from the
+// per-IP and per-subnet limits so that several local nodes can connect
+func isLoopback(address string) bool {
+	if address == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(address)
+	return ip != nil && ip.IsLoopback()
+}
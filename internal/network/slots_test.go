@@ -0,0 +1,154 @@
+package network
+
+import (
+	"blockchain-go/internal/blockchain"
+	"blockchain-go/internal/config"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSlotsManager returns a manager that is not listening, accepting up to
+// maxInbound inbound peers
+func newSlotsManager(maxInbound int) *Manager {
+	cfg := config.Default().Network
+	cfg.BanFile = ""
+	cfg.IdentityFile = ""
+	cfg.MaxInboundPeers = maxInbound
+
+	bc := blockchain.New(config.Default().Blockchain.DifficultyCalculationBlocks, 1)
+	return NewManagerWithTransport(cfg, bc, NewMemoryNetwork().Transport("10.9.9.9"))
+}
+
+// addInbound adds inbound peers from the given hosts, returning them in order
+func addInbound(t *testing.T, m *Manager, hosts ...string) []*Peer {
+	t.Helper()
+
+	peers := make([]*Peer, 0, len(hosts))
+	for i, host := range hosts {
+		peer := NewPeer(fmt.Sprintf("peer-%s-%d", host, i), 0, host, testPort)
+		if err := m.addInboundPeer(host, peer); err != nil {
+			t.Fatalf("failed to add inbound peer %s: %v", host, err)
+		}
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// hasPeer checks if a peer is still connected
+func hasPeer(m *Manager, peer *Peer) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.hasPeerInternal(peer)
+}
+
+func TestEvictionOrder(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		victim  int
+		prepare func(peers []*Peer)
+	}{
+		{"most failures", 1, func(p []*Peer) {
+			p[1].failures = 2
+			p[2].failures = 1
+		}},
+		{"oldest block delivery", 2, func(p []*Peer) {
+			for _, peer := range p {
+				peer.lastBlock = now.Add(-time.Hour)
+			}
+			p[2].lastBlock = now.Add(-2 * time.Hour)
+		}},
+		{"highest latency", 0, func(p []*Peer) {
+			p[0].latency = 300 * time.Millisecond
+			p[1].latency = 100 * time.Millisecond
+		}},
+		{"most recent connection", 1, func(p []*Peer) {
+			for i, peer := range p {
+				peer.addedAt = now.Add(-time.Duration(10-i) * time.Minute)
+			}
+			p[1].addedAt = now
+		}},
+		{"failures before latency", 2, func(p []*Peer) {
+			p[0].latency = time.Second
+			p[2].failures = 1
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newSlotsManager(3)
+			peers := addInbound(t, m, "10.0.1.1", "10.0.2.1", "10.0.3.1")
+
+			// Ties on every criterion evict the most recent peer
+			for i, peer := range peers {
+				peer.addedAt = now.Add(-time.Duration(10-i) * time.Minute)
+			}
+
+			m.mu.Lock()
+			test.prepare(peers)
+			m.mu.Unlock()
+
+			addInbound(t, m, "10.0.4.1")
+			for i, peer := range peers {
+				if connected := hasPeer(m, peer); connected == (i == test.victim) {
+					t.Fatalf("peer %d connected %v, want peer %d evicted", i, connected, test.victim)
+				}
+			}
+		})
+	}
+}
+
+func TestEvictionCrowdedSubnetFirst(t *testing.T) {
+	m := newSlotsManager(4)
+	peers := addInbound(t, m, "10.0.1.1", "10.0.2.1", "10.0.2.2", "10.0.3.1")
+
+	// A peer of a crowded subnet goes before a failing peer of its own subnet
+	m.mu.Lock()
+	peers[0].failures = 5
+	m.mu.Unlock()
+
+	addInbound(t, m, "10.0.4.1")
+	if !hasPeer(m, peers[0]) {
+		t.Fatal("peer of its own subnet evicted before the crowded subnet")
+	}
+	if hasPeer(m, peers[1]) && hasPeer(m, peers[2]) {
+		t.Fatal("no peer of the crowded subnet evicted")
+	}
+}
+
+func TestEvictionProtection(t *testing.T) {
+	m := newSlotsManager(2)
+	peers := addInbound(t, m, "10.0.1.1", "10.0.2.1")
+
+	for _, peer := range peers {
+		m.recordPeerBlock(peer)
+	}
+
+	err := m.addInboundPeer("10.0.3.1", NewPeer("newcomer", 0, "10.0.3.1", testPort))
+	if err == nil || !strings.Contains(err.Error(), "full") {
+		t.Fatalf("peer added with every inbound peer protected: %v", err)
+	}
+	for _, peer := range peers {
+		if !hasPeer(m, peer) {
+			t.Fatalf("protected peer %s evicted", peer.Host)
+		}
+	}
+}
+
+func TestInboundAddressLimits(t *testing.T) {
+	m := newSlotsManager(32)
+	m.config.MaxPeersPerIP = 1
+	m.config.MaxPeersPerSubnet = 2
+
+	addInbound(t, m, "10.0.1.1", "10.0.1.2", "127.0.0.1", "127.0.0.1")
+
+	if err := m.addInboundPeer("10.0.1.1", NewPeer("same-ip", 0, "10.0.1.1", testPort+1)); err == nil {
+		t.Fatal("second peer from the same IP accepted")
+	}
+	if err := m.addInboundPeer("10.0.1.3", NewPeer("same-subnet", 0, "10.0.1.3", testPort)); err == nil {
+		t.Fatal("third peer from the same subnet accepted")
+	}
+}
@@ -0,0 +1,172 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Transport creates the connections used to exchange packets between peers
+type Transport interface {
+	// Listen listens for incoming connections on the given host:port address
+	Listen(address string) (net.Listener, error)
+
+	// Dial connects to the given host:port address
+	Dial(address string, timeout time.Duration) (net.Conn, error)
+}
+
+// TCPTransport is the transport over real TCP connections
+type TCPTransport struct{}
+
+// Listen listens on every interface on the port of the given address
+func (TCPTransport) Listen(address string) (net.Listener, error) {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listen address %s: %w", address, err)
+	}
+
+	return net.Listen("tcp", ":"+port)
+}
+
+// Dial connects to the given address over TCP
+func (TCPTransport) Dial(address string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout("tcp", address, timeout)
+}
+
+// MemoryNetwork is an in-process network of listeners connected through
+// channels, used to run many nodes in a single process without real ports
+type MemoryNetwork struct {
+	mu        sync.RWMutex
+	listeners map[string]*memoryListener
+}
+
+// NewMemoryNetwork creates an empty in-memory network
+func NewMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{
+		listeners: make(map[string]*memoryListener),
+	}
+}
+
+// Transport returns a transport of the network for a node on the given host.
+// Connections dialed through it report that host as their remote address.
+func (mn *MemoryNetwork) Transport(host string) Transport {
+	return &memoryTransport{network: mn, host: host}
+}
+
+// memoryTransport is a transport attached to a memory network
+type memoryTransport struct {
+	network *MemoryNetwork
+	host    string
+}
+
+// Listen registers a listener on the network at the given address
+func (mt *memoryTransport) Listen(address string) (net.Listener, error) {
+	mt.network.mu.Lock()
+	defer mt.network.mu.Unlock()
+
+	if _, exists := mt.network.listeners[address]; exists {
+		return nil, fmt.Errorf("address %s already in use", address)
+	}
+
+	listener := &memoryListener{
+		network: mt.network,
+		address: memoryAddr(address),
+		conns:   make(chan net.Conn),
+		closed:  make(chan struct{}),
+	}
+	mt.network.listeners[address] = listener
+	return listener, nil
+}
+
+// Dial connects to the listener registered at the given address
+func (mt *memoryTransport) Dial(address string, timeout time.Duration) (net.Conn, error) {
+	mt.network.mu.RLock()
+	listener, exists := mt.network.listeners[address]
+	mt.network.mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("dial %s: connection refused", address)
+	}
+
+	clientConn, serverConn := net.Pipe()
+	localAddr := memoryAddr(net.JoinHostPort(mt.host, "0"))
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case listener.conns <- &memoryConn{Conn: serverConn, local: listener.address, remote: localAddr}:
+		return &memoryConn{Conn: clientConn, local: localAddr, remote: listener.address}, nil
+	case <-listener.closed:
+		return nil, fmt.Errorf("dial %s: connection refused", address)
+	case <-timer.C:
+		return nil, fmt.Errorf("dial %s: timeout", address)
+	}
+}
+
+// memoryListener accepts connections dialed on a memory network
+type memoryListener struct {
+	network   *MemoryNetwork
+	address   memoryAddr
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Accept waits for the next connection
+func (ml *memoryListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-ml.conns:
+		return conn, nil
+	case <-ml.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close unregisters the listener from the network
+func (ml *memoryListener) Close() error {
+	ml.closeOnce.Do(func() {
+		close(ml.closed)
+
+		ml.network.mu.Lock()
+		delete(ml.network.listeners, string(ml.address))
+		ml.network.mu.Unlock()
+	})
+	return nil
+}
+
+// Addr returns the listener address
+func (ml *memoryListener) Addr() net.Addr {
+	return ml.address
+}
+
+// memoryConn is an in-memory connection with memory network addresses
+type memoryConn struct {
+	net.Conn
+	local  net.Addr
+	remote net.Addr
+}
+
+// LocalAddr returns the local address of the connection
+func (mc *memoryConn) LocalAddr() net.Addr {
+	return mc.local
+}
+
+// RemoteAddr returns the remote address of the connection
+func (mc *memoryConn) RemoteAddr() net.Addr {
+	return mc.remote
+}
+
+// memoryAddr is an address on a memory network
+type memoryAddr string
+
+// Network returns the network name of the address
+func (ma memoryAddr) Network() string {
+	return "memory"
+}
+
+// String returns the address
+func (ma memoryAddr) String() string {
+	return string(ma)
+}
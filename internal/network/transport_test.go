@@ -0,0 +1,181 @@
+package network
+
+import (
+	"blockchain-go/internal/blockchain"
+	"blockchain-go/internal/config"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testPort is the port of every node of the test networks
+const testPort = 8333
+
+// testNode is a node of a memory network
+type testNode struct {
+	host       string
+	blockchain *blockchain.Blockchain
+	manager    *Manager
+}
+
+// newTestNode starts a node on the memory network, listening at the given host
+func newTestNode(t *testing.T, mn *MemoryNetwork, host string, seeds ...string) *testNode {
+	t.Helper()
+
+	cfg := config.Default().Network
+	cfg.Host = host
+	cfg.Port = testPort
+	cfg.BanFile = ""
+	cfg.IdentityFile = ""
+	cfg.SeedPeers = seeds
+
+	bc := blockchain.New(config.Default().Blockchain.DifficultyCalculationBlocks, 1)
+	bc.SetFixedDifficulty(blockchain.RegtestDifficulty)
+
+	manager := NewManagerWithTransport(cfg, bc, mn.Transport(host))
+	go manager.StartServer()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		manager.Shutdown(ctx)
+	})
+
+	// Wait for the server to listen before other nodes dial it
+	address := net.JoinHostPort(host, strconv.Itoa(testPort))
+	waitFor(t, fmt.Sprintf("%s to listen", address), func() bool {
+		mn.mu.RLock()
+		defer mn.mu.RUnlock()
+		_, listening := mn.listeners[address]
+		return listening
+	})
+
+	return &testNode{host: host, blockchain: bc, manager: manager}
+}
+
+// mineBlocks mines blocks on top of the tip of the chain
+func mineBlocks(t *testing.T, bc *blockchain.Blockchain, count int) []*blockchain.Block {
+	t.Helper()
+
+	blocks := make([]*blockchain.Block, 0, count)
+	for i := 0; i < count; i++ {
+		latest, err := bc.GetLatestBlock()
+		if err != nil {
+			t.Fatalf("failed to get latest block: %v", err)
+		}
+
+		block := blockchain.NewBlock(latest.Index+1, latest.NextBlockDifficulty, latest.NextBlockDifficulty,
+			fmt.Sprintf("block %d", latest.Index+1), latest.Hash)
+		block.Mine(bc.GetPoW())
+		if err := bc.AddBlock(block); err != nil {
+			t.Fatalf("failed to add block #%d: %v", block.Index, err)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// waitFor polls a condition until it holds, failing the test after a timeout
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// tipHash returns the hash of the latest block of a node, empty for an empty chain
+func (n *testNode) tipHash() string {
+	latest, err := n.blockchain.GetLatestBlock()
+	if err != nil {
+		return ""
+	}
+	return latest.Hash
+}
+
+func TestMemoryNetworkSync(t *testing.T) {
+	mn := NewMemoryNetwork()
+
+	origin := newTestNode(t, mn, "10.0.0.1")
+	origin.blockchain.CreateGenesisBlock()
+	mineBlocks(t, origin.blockchain, 20)
+
+	// Later nodes also sync headers first from the nodes joined before them
+	nodes := []*testNode{origin}
+	for i := 2; i <= 4; i++ {
+		seeds := make([]string, 0, len(nodes)-1)
+		for _, node := range nodes[1:] {
+			seeds = append(seeds, net.JoinHostPort(node.host, strconv.Itoa(testPort)))
+		}
+
+		node := newTestNode(t, mn, fmt.Sprintf("10.0.0.%d", i), seeds...)
+		if err := node.manager.Join(origin.host, testPort); err != nil {
+			t.Fatalf("node %s failed to join: %v", node.host, err)
+		}
+
+		if got, want := node.tipHash(), origin.tipHash(); got != want {
+			t.Fatalf("node %s synced to tip %s, want %s", node.host, got, want)
+		}
+		nodes = append(nodes, node)
+	}
+
+	// A new block announced by the origin reaches every node
+	block := mineBlocks(t, origin.blockchain, 1)[0]
+	if err := origin.manager.AnnounceBlock(block); err != nil {
+		t.Fatalf("failed to announce block: %v", err)
+	}
+
+	for _, node := range nodes[1:] {
+		waitFor(t, fmt.Sprintf("node %s to receive block #%d", node.host, block.Index), func() bool {
+			return node.blockchain.HasBlockHash(block.Hash)
+		})
+	}
+}
+
+func TestMemoryNetworkRefusedDial(t *testing.T) {
+	mn := NewMemoryNetwork()
+
+	if _, err := mn.Transport("10.0.0.1").Dial("10.0.0.2:8333", time.Second); err == nil {
+		t.Fatal("dial to an address without listener succeeded")
+	}
+
+	listener, err := mn.Transport("10.0.0.2").Listen("10.0.0.2:8333")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	if _, err := mn.Transport("10.0.0.3").Listen("10.0.0.2:8333"); err == nil {
+		t.Fatal("second listener on the same address succeeded")
+	}
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	conn, err := mn.Transport("10.0.0.1").Dial("10.0.0.2:8333", time.Second)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	remote := <-accepted
+	defer remote.Close()
+	if host, _, _ := net.SplitHostPort(remote.RemoteAddr().String()); host != "10.0.0.1" {
+		t.Fatalf("accepted connection reports remote host %s, want 10.0.0.1", host)
+	}
+
+	listener.Close()
+	if _, err := mn.Transport("10.0.0.1").Dial("10.0.0.2:8333", time.Second); err == nil {
+		t.Fatal("dial to a closed listener succeeded")
+	}
+}
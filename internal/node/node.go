@@ -0,0 +1,179 @@
+package node
+
+import (
+	"blockchain-go/internal/api"
+	"blockchain-go/internal/blockchain"
+	"blockchain-go/internal/config"
+	"blockchain-go/internal/miner"
+	"blockchain-go/internal/network"
+	"blockchain-go/internal/pool"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// shutdownTimeout is the time given to in-flight requests to complete on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// Node wires the blockchain, the network, the admin API, the miner and the
+// mining pool of a running node together
+type Node struct {
+	config     *config.Config
+	blockchain *blockchain.Blockchain
+	network    *network.Manager
+	api        *api.Server
+	miner      *miner.Miner
+	pool       *pool.Server
+}
+
+// New creates a node, joining the network through the given initial peer or
+// seed peers, or starting a new network when there is none
+func New(cfg *config.Config, initHost string, initPort int) (*Node, error) {
+	// Create blockchain instance
+	bc := blockchain.New(cfg.Blockchain.DifficultyCalculationBlocks, cfg.Blockchain.TargetBlockTime)
+	bc.SetGenesisHash(cfg.Blockchain.GenesisHash)
+
+	pow, err := blockchain.PoWByName(cfg.Blockchain.PoW)
+	if err != nil {
+		return nil, fmt.Errorf("invalid blockchain configuration: %w", err)
+	}
+	bc.SetPoW(pow)
+
+	// Regtest blocks are solved instantly and only mined on demand
+	minerConfig := cfg.Miner
+	if cfg.Blockchain.Regtest {
+		bc.SetFixedDifficulty(blockchain.RegtestDifficulty)
+		minerConfig.Enabled = false
+	}
+
+	// Restrict the network to known nodes in permissioned mode
+	if cfg.Permission.Enabled {
+		membership, err := blockchain.NewMembership(cfg.Permission.Members, cfg.Permission.Producers)
+		if err != nil {
+			return nil, fmt.Errorf("invalid permission configuration: %w", err)
+		}
+		bc.SetMembership(membership)
+	}
+
+	// Create network manager
+	var nm *network.Manager
+	if initHost != "" && initPort != 0 {
+		// Join existing network
+		var err error
+		nm, err = network.NewJoiningManager(cfg.Network, bc, initHost, initPort)
+		if err != nil {
+			return nil, fmt.Errorf("failed to join network: %w", err)
+		}
+	} else {
+		// Create genesis block and start new network
+		genesisBlock := bc.CreateGenesisBlock()
+		log.Printf("Created genesis block: %s", genesisBlock.Hash)
+		nm = network.NewManager(cfg.Network, bc)
+	}
+
+	n := &Node{
+		config:     cfg,
+		blockchain: bc,
+		network:    nm,
+		miner:      miner.NewMiner(nm, minerConfig),
+	}
+
+	if cfg.Pool.Enabled {
+		n.pool = pool.NewServer(cfg.Pool, miner.NewLocalWorkSource(nm))
+	}
+
+	if cfg.API.Enabled {
+		n.api = api.NewServer(cfg.API, nm)
+		n.api.SetMiner(n.miner)
+		if n.pool != nil {
+			n.api.SetPool(n.pool)
+		}
+	}
+
+	return n, nil
+}
+
+// Run starts the node and blocks until the context is done, then shuts the
+// node down: mining stops first, then the admin API and the network drain
+// their in-flight requests and the ban list is saved
+func (n *Node) Run(ctx context.Context) error {
+	// Start network server
+	go n.network.StartServer()
+	log.Printf("P2P Network started on port %d", n.config.Network.Port)
+
+	// Start peer liveness monitoring
+	go n.network.StartPeerMonitor()
+
+	// Start admin API
+	if n.api != nil {
+		go n.api.Start()
+	}
+
+	// Start mining pool
+	if n.pool != nil {
+		go n.pool.Start()
+	}
+
+	// Start mining, paused on regtest chains and when disabled
+	if n.config.Blockchain.Regtest {
+		log.Println("Regtest mode: blocks are mined by the generate command")
+	}
+
+	minerDone := make(chan struct{})
+	go func() {
+		defer close(minerDone)
+		n.miner.Start()
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	var errs []error
+
+	// Stop mining before the network so that no block is added or announced
+	// while shutting down
+	n.miner.Stop()
+	select {
+	case <-minerDone:
+	case <-shutdownCtx.Done():
+		errs = append(errs, fmt.Errorf("miner did not stop: %w", shutdownCtx.Err()))
+	}
+
+	if n.pool != nil {
+		if err := n.pool.Shutdown(shutdownCtx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to stop mining pool: %w", err))
+		}
+	}
+
+	if n.api != nil {
+		if err := n.api.Shutdown(shutdownCtx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to stop admin API: %w", err))
+		}
+	}
+
+	if err := n.network.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to stop network: %w", err))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	log.Println("Node stopped")
+	return nil
+}
+
+// GetBlockchain returns the blockchain of the node
+func (n *Node) GetBlockchain() *blockchain.Blockchain {
+	return n.blockchain
+}
+
+// GetNetworkManager returns the network manager of the node
+func (n *Node) GetNetworkManager() *network.Manager {
+	return n.network
+}
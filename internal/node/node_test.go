@@ -0,0 +1,62 @@
+package node
+
+import (
+	"blockchain-go/internal/blockchain"
+	"blockchain-go/internal/config"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Every node logs its identity and genesis block
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testConfig returns the configuration of a regtest node that saves nothing
+// and serves neither the admin API nor a pool
+func testConfig(pow string) *config.Config {
+	cfg := config.Default()
+	cfg.Blockchain.PoW = pow
+	cfg.Blockchain.Regtest = true
+	cfg.Network.BanFile = ""
+	cfg.Network.IdentityFile = ""
+	cfg.API.Enabled = false
+	cfg.Pool.Enabled = false
+	return cfg
+}
+
+func TestNewSelectsPoW(t *testing.T) {
+	for _, name := range append(blockchain.PoWNames(), "") {
+		n, err := New(testConfig(name), "", 0)
+		if err != nil {
+			t.Fatalf("node with proof-of-work %q not created: %v", name, err)
+		}
+
+		pow := n.blockchain.GetPoW()
+		if name != "" && pow.Name() != name {
+			t.Fatalf("node configured with %s uses %s", name, pow.Name())
+		}
+		if name == "" && pow != blockchain.DefaultPoW {
+			t.Fatalf("node without proof-of-work uses %s, want the default", pow.Name())
+		}
+
+		genesis, err := n.blockchain.GetBlock(0)
+		if err != nil || genesis.IsValid(pow) != nil {
+			t.Fatalf("genesis block of a %s node not mined with its function", pow.Name())
+		}
+	}
+}
+
+func TestNewRejectsUnknownPoW(t *testing.T) {
+	_, err := New(testConfig("scrypt"), "", 0)
+	if err == nil {
+		t.Fatal("node created with an unknown proof-of-work function")
+	}
+	if !strings.Contains(err.Error(), "scrypt") || !strings.Contains(err.Error(), blockchain.PoWSHA512) {
+		t.Fatalf("error %q does not name the unknown and available functions", err)
+	}
+}
@@ -0,0 +1,313 @@
+package pool
+
+import (
+	"blockchain-go/internal/blockchain"
+	"blockchain-go/internal/miner"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// requestTimeout is the time given to the pool to answer a request
+const requestTimeout = 30 * time.Second
+
+// maxQueuedShares is the number of shares waiting to be submitted
+const maxQueuedShares = 64
+
+// Errors of the session with the pool
+var (
+	errClosed         = errors.New("pool connection closed")
+	errShareQueueFull = errors.New("share queue full, dropping share")
+)
+
+// message is a line received from the pool, either a response or a notification
+type message struct {
+	ID     *int64          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *string         `json:"error"`
+}
+
+// Client is the session of a miner with a pool. It is the work source of the
+// miner, handing out the jobs of the pool and submitting shares to it.
+type Client struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+	encoder *json.Encoder
+
+	mu       sync.Mutex
+	nextID   int64
+	pending  map[int64]chan *message
+	jobs     []*Job
+	jobReady chan struct{}
+
+	shares chan *blockchain.Block
+	tips   chan *blockchain.Block
+	closed chan struct{}
+}
+
+// Dial opens a session with the pool at the given address, crediting its
+// shares to the given worker
+func Dial(address string, worker string) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", address, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to pool: %w", err)
+	}
+
+	c := &Client{
+		conn:     conn,
+		encoder:  json.NewEncoder(conn),
+		pending:  make(map[int64]chan *message),
+		jobReady: make(chan struct{}),
+		shares:   make(chan *blockchain.Block, maxQueuedShares),
+		tips:     make(chan *blockchain.Block, 1),
+		closed:   make(chan struct{}),
+	}
+	go c.readLoop()
+
+	var subscription SubscribeResult
+	if err := c.call(MethodSubscribe, nil, &subscription); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to subscribe: %w", err)
+	}
+
+	if err := c.call(MethodAuthorize, AuthorizeParams{Worker: worker}, nil); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to authorize worker %s: %w", worker, err)
+	}
+
+	go c.submitLoop()
+	return c, nil
+}
+
+// Close ends the session
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Done is closed when the session ends
+func (c *Client) Done() <-chan struct{} {
+	return c.closed
+}
+
+// GetBlockTemplate returns the template of the latest job, waiting for the
+// first job of the session
+func (c *Client) GetBlockTemplate() (*miner.BlockTemplate, error) {
+	select {
+	case <-c.jobReady:
+	case <-c.closed:
+		return nil, errClosed
+	case <-time.After(requestTimeout):
+		return nil, fmt.Errorf("no job received from the pool")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Refresh the timestamp so that templates of the same job requested
+	// after each other yield different hashes
+	template := c.jobs[len(c.jobs)-1].BlockTemplate
+	if now := time.Now().Unix(); now > template.Timestamp {
+		template.Timestamp = now
+	}
+	return &template, nil
+}
+
+// SubmitBlock submits a solved block as a share, failing if the pool did not
+// accept it as a block
+func (c *Client) SubmitBlock(block *blockchain.Block) error {
+	result, err := c.submit(block)
+	if err != nil {
+		return err
+	}
+	if !result.Block {
+		return fmt.Errorf("pool did not accept block #%d", block.Index)
+	}
+	return nil
+}
+
+// SubmitShare queues a share of a job. Shares are submitted in the background
+// so that the worker that found them keeps hashing meanwhile.
+func (c *Client) SubmitShare(block *blockchain.Block) error {
+	select {
+	case c.shares <- block:
+		return nil
+	case <-c.closed:
+		return errClosed
+	default:
+		return errShareQueueFull
+	}
+}
+
+// SubscribeTip notifies the tips of clean jobs, built on a new tip. Only the
+// hash of the notified blocks is set.
+func (c *Client) SubscribeTip() (<-chan *blockchain.Block, func()) {
+	return c.tips, func() {}
+}
+
+// submitLoop submits the queued shares until the session ends
+func (c *Client) submitLoop() {
+	for {
+		select {
+		case block := <-c.shares:
+			if _, err := c.submit(block); err != nil {
+				log.Printf("Share rejected: %v", err)
+			}
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// submit submits a block solved from one of the jobs of the session
+func (c *Client) submit(block *blockchain.Block) (*SubmitResult, error) {
+	j := c.jobOf(block)
+	if j == nil {
+		return nil, errStaleJob
+	}
+
+	params := SubmitParams{
+		JobID:      j.ID,
+		Nonce:      block.Nonce,
+		ExtraNonce: block.ExtraNonce,
+		Timestamp:  block.Timestamp,
+	}
+
+	var result SubmitResult
+	if err := c.call(MethodSubmit, params, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// jobOf finds the job a block was mined from, the latest one of its tip and
+// data not started after the block timestamp
+func (c *Client) jobOf(block *blockchain.Block) *Job {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := len(c.jobs) - 1; i >= 0; i-- {
+		j := c.jobs[i]
+		if j.PreviousHash == block.PreviousHash && j.DataHash == block.DataHash && j.Timestamp <= block.Timestamp {
+			return j
+		}
+	}
+	return nil
+}
+
+// call sends a request and waits for its response, decoding its result
+func (c *Client) call(method string, params interface{}, result interface{}) error {
+	request := Request{Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		request.Params = data
+	}
+
+	answer := make(chan *message, 1)
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = answer
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	request.ID = &id
+	c.writeMu.Lock()
+	err := c.encoder.Encode(request)
+	c.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	select {
+	case response := <-answer:
+		if response.Error != nil {
+			return errors.New(*response.Error)
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(response.Result, result)
+	case <-c.closed:
+		return errClosed
+	case <-time.After(requestTimeout):
+		return fmt.Errorf("pool did not answer %s", method)
+	}
+}
+
+// readLoop dispatches the responses and notifications of the pool until the
+// connection is closed
+func (c *Client) readLoop() {
+	defer close(c.closed)
+	defer c.conn.Close()
+
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxLineSize)
+
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			return
+		}
+
+		if msg.ID == nil {
+			if msg.Method == MethodNotify {
+				c.handleJob(msg.Params)
+			}
+			continue
+		}
+
+		c.mu.Lock()
+		answer, exists := c.pending[*msg.ID]
+		c.mu.Unlock()
+		if exists {
+			answer <- &msg
+		}
+	}
+}
+
+// handleJob records a job notified by the pool
+func (c *Client) handleJob(params json.RawMessage) {
+	var j Job
+	if err := json.Unmarshal(params, &j); err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	first := len(c.jobs) == 0
+	if j.CleanJobs {
+		c.jobs = nil
+	}
+	c.jobs = append(c.jobs, &j)
+	if len(c.jobs) > maxJobs {
+		c.jobs = c.jobs[len(c.jobs)-maxJobs:]
+	}
+	c.mu.Unlock()
+
+	if first {
+		close(c.jobReady)
+	}
+
+	if j.CleanJobs && !first {
+		// Replace a tip the miner did not read yet
+		select {
+		case <-c.tips:
+		default:
+		}
+		c.tips <- &blockchain.Block{BlockHeader: blockchain.BlockHeader{Index: j.Index - 1, Hash: j.PreviousHash}}
+	}
+}
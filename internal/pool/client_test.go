@@ -0,0 +1,52 @@
+package pool
+
+import (
+	"blockchain-go/internal/blockchain"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSubmitShareDoesNotWait(t *testing.T) {
+	// The pool reads the requests but never answers them
+	conn, poolConn := net.Pipe()
+	defer poolConn.Close()
+	go func() {
+		decoder := json.NewDecoder(poolConn)
+		for {
+			var request Request
+			if err := decoder.Decode(&request); err != nil {
+				return
+			}
+		}
+	}()
+
+	c := &Client{
+		conn:     conn,
+		encoder:  json.NewEncoder(conn),
+		pending:  make(map[int64]chan *message),
+		jobs:     []*Job{{ID: "1"}},
+		jobReady: make(chan struct{}),
+		shares:   make(chan *blockchain.Block, maxQueuedShares),
+		tips:     make(chan *blockchain.Block, 1),
+		closed:   make(chan struct{}),
+	}
+	go c.readLoop()
+	go c.submitLoop()
+	defer c.Close()
+
+	start := time.Now()
+	var err error
+	for i := 0; i <= maxQueuedShares+1 && err == nil; i++ {
+		err = c.SubmitShare(&blockchain.Block{})
+	}
+
+	if !errors.Is(err, errShareQueueFull) {
+		t.Fatalf("share beyond the queue returned %v, want %v", err, errShareQueueFull)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("queueing shares took %v while the pool did not answer", elapsed)
+	}
+}
@@ -0,0 +1,74 @@
+package pool
+
+import (
+	"blockchain-go/internal/miner"
+	"encoding/json"
+)
+
+// Methods of the pool protocol. Miners send one JSON request per line and the
+// pool answers each of them with one JSON response per line, in between
+// notifications of new jobs.
+const (
+	// MethodSubscribe opens a mining session and returns its extra nonce range
+	MethodSubscribe = "mining.subscribe"
+
+	// MethodAuthorize names the worker the shares of the session are credited to
+	MethodAuthorize = "mining.authorize"
+
+	// MethodSubmit submits a share of a job
+	MethodSubmit = "mining.submit"
+
+	// MethodNotify notifies a new job, sent by the pool
+	MethodNotify = "mining.notify"
+)
+
+// Request is a request of a miner, or a notification of the pool when ID is nil
+type Request struct {
+	ID     *int64          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Response answers a request
+type Response struct {
+	ID     *int64      `json:"id"`
+	Result interface{} `json:"result"`
+	Error  *string     `json:"error"`
+}
+
+// SubscribeResult holds the extra nonce range [ExtraNonceStart, ExtraNonceEnd) of a session
+type SubscribeResult struct {
+	ExtraNonceStart uint64 `json:"extra_nonce_start"`
+	ExtraNonceEnd   uint64 `json:"extra_nonce_end"`
+}
+
+// AuthorizeParams are the parameters of an authorization request
+type AuthorizeParams struct {
+	Worker string `json:"worker"`
+}
+
+// Job is a block template to mine within the extra nonce range of the session
+type Job struct {
+	ID string `json:"job_id"`
+	miner.BlockTemplate
+
+	// ExtraNonceEnd ends the extra nonce range starting at ExtraNonce
+	ExtraNonceEnd uint64 `json:"extra_nonce_end"`
+
+	// CleanJobs tells miners to abandon previous jobs, which built on another tip
+	CleanJobs bool `json:"clean_jobs"`
+}
+
+// SubmitParams are the parameters of a share submission
+type SubmitParams struct {
+	JobID      string `json:"job_id"`
+	Nonce      int    `json:"nonce"`
+	ExtraNonce uint64 `json:"extra_nonce"`
+	Timestamp  int64  `json:"timestamp"`
+}
+
+// SubmitResult tells whether a share also solved the block
+type SubmitResult struct {
+	Block bool   `json:"block"`
+	Hash  string `json:"hash"`
+}
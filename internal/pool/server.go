@@ -0,0 +1,604 @@
+package pool
+
+import (
+	"blockchain-go/internal/blockchain"
+	"blockchain-go/internal/config"
+	"blockchain-go/internal/miner"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// extraNonceRange is the size of the extra nonce range of each session
+const extraNonceRange = 1 << 32
+
+// maxJobs is the number of jobs of the current tip accepting shares
+const maxJobs = 8
+
+// maxLineSize is the maximum size of a request line
+const maxLineSize = 64 * 1024
+
+// maxTimestampDrift is how far in the future the timestamp of a share may be
+const maxTimestampDrift = 2 * time.Minute
+
+// maxRejectedShares is the number of consecutive rejected shares after which
+// a session is disconnected
+const maxRejectedShares = 32
+
+// maxWorkers is the number of workers whose statistics are kept. Idle workers
+// are forgotten to make room for new ones.
+const maxWorkers = 1024
+
+// Errors of rejected shares
+var (
+	errStaleJob       = errors.New("stale job")
+	errUnauthorized   = errors.New("worker not authorized")
+	errDuplicateShare = errors.New("duplicate share")
+	errLowDifficulty  = errors.New("share does not meet the share difficulty")
+	errTooManyWorkers = errors.New("too many workers")
+)
+
+// WorkerStats holds the shares submitted by a worker
+type WorkerStats struct {
+	Worker    string    `json:"worker"`
+	Sessions  int       `json:"sessions"`
+	Accepted  int       `json:"accepted"`
+	Rejected  int       `json:"rejected"`
+	Stale     int       `json:"stale"`
+	Blocks    int       `json:"blocks"`
+	LastShare time.Time `json:"last_share"`
+}
+
+// job is a block template handed out to the sessions
+type job struct {
+	id       string
+	template *miner.BlockTemplate
+	pow      blockchain.PoW
+	shares   map[string]bool
+}
+
+// Server is a mining pool serving jobs derived from the block templates of a
+// work source to miners over TCP, one JSON message per line
+type Server struct {
+	config config.PoolConfig
+	source miner.WorkSource
+
+	mu             sync.Mutex
+	jobs           []*job
+	nextJobID      uint64
+	nextExtraNonce uint64
+	sessions       map[*session]bool
+	workers        map[string]*WorkerStats
+
+	// Lifecycle of the server, guarded by mu
+	listener    net.Listener
+	stop        chan struct{}
+	stopped     bool
+	connections sync.WaitGroup
+}
+
+// session is the connection of a miner
+type session struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+	encoder *json.Encoder
+
+	// Guarded by the server mutex
+	subscribed      bool
+	extraNonceStart uint64
+	worker          string
+	rejected        int
+}
+
+// NewServer creates a pool handing out jobs of the given work source
+func NewServer(cfg config.PoolConfig, source miner.WorkSource) *Server {
+	return &Server{
+		config:   cfg,
+		source:   source,
+		sessions: make(map[*session]bool),
+		workers:  make(map[string]*WorkerStats),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start listens for miners and hands out jobs until Shutdown is called
+func (s *Server) Start() {
+	address := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Printf("Failed to start mining pool: %v", err)
+		return
+	}
+	defer listener.Close()
+
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	s.listener = listener
+	s.mu.Unlock()
+
+	log.Printf("Mining pool listening on %s (share difficulty %d)", address, s.config.ShareDifficulty)
+	go s.runJobs()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.isStopped() {
+				return
+			}
+			log.Printf("Failed to accept miner connection: %v", err)
+			continue
+		}
+
+		sess := &session{conn: conn, encoder: json.NewEncoder(conn)}
+		if !s.trackSession(sess) {
+			conn.Close()
+			return
+		}
+
+		go func() {
+			defer s.connections.Done()
+			s.handleSession(sess)
+		}()
+	}
+}
+
+// Shutdown stops accepting miners, disconnects the connected ones and waits
+// for their sessions to end until the context is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.stopped {
+		s.stopped = true
+		close(s.stop)
+	}
+	listener := s.listener
+	for sess := range s.sessions {
+		sess.conn.Close()
+	}
+	s.mu.Unlock()
+
+	if listener != nil {
+		listener.Close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.connections.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("miner sessions still open: %w", ctx.Err())
+	}
+}
+
+// Stats returns the share statistics of every worker
+func (s *Server) Stats() []WorkerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make([]WorkerStats, 0, len(s.workers))
+	for _, worker := range s.workers {
+		stats = append(stats, *worker)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Worker < stats[j].Worker
+	})
+	return stats
+}
+
+// isStopped checks if Shutdown was called
+func (s *Server) isStopped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopped
+}
+
+// trackSession registers a session to close on shutdown, refusing it once
+// shutdown has started
+func (s *Server) trackSession(sess *session) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return false
+	}
+	s.sessions[sess] = true
+	s.connections.Add(1)
+	return true
+}
+
+// runJobs creates a new job whenever the tip changes and once per job refresh interval
+func (s *Server) runJobs() {
+	var tips <-chan *blockchain.Block
+	if notifier, ok := s.source.(miner.TipNotifier); ok {
+		var unsubscribe func()
+		tips, unsubscribe = notifier.SubscribeTip()
+		defer unsubscribe()
+	}
+
+	refresh := time.Duration(s.config.JobRefresh) * time.Second
+	if refresh <= 0 {
+		refresh = 30 * time.Second
+	}
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+
+	s.refreshJob()
+	for {
+		select {
+		case <-tips:
+			s.refreshJob()
+		case <-ticker.C:
+			s.refreshJob()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// refreshJob creates a job from a new template and notifies it to every
+// session. Jobs of a previous tip are dropped.
+func (s *Server) refreshJob() {
+	template, err := s.source.GetBlockTemplate()
+	if err != nil {
+		log.Printf("Failed to get block template for the pool: %v", err)
+		return
+	}
+	// Shares are never harder than the block itself, nor free to compute
+	template.ShareDifficulty = s.config.ShareDifficulty
+	if template.ShareDifficulty > template.Difficulty {
+		template.ShareDifficulty = template.Difficulty
+	}
+	if template.ShareDifficulty < 1 {
+		template.ShareDifficulty = 1
+	}
+
+	pow, err := template.ProofOfWork()
+	if err != nil {
+		log.Printf("Failed to create pool job: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	clean := len(s.jobs) == 0 || s.jobs[len(s.jobs)-1].template.PreviousHash != template.PreviousHash
+	if clean {
+		s.jobs = nil
+	}
+
+	s.nextJobID++
+	current := &job{
+		id:       strconv.FormatUint(s.nextJobID, 16),
+		template: template,
+		pow:      pow,
+		shares:   make(map[string]bool),
+	}
+	s.jobs = append(s.jobs, current)
+	if len(s.jobs) > maxJobs {
+		s.jobs = s.jobs[len(s.jobs)-maxJobs:]
+	}
+
+	sessions := make([]*session, 0, len(s.sessions))
+	for sess := range s.sessions {
+		if sess.subscribed {
+			sessions = append(sessions, sess)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, sess := range sessions {
+		s.notify(sess, current, clean)
+	}
+}
+
+// notify sends a job to a session, restricted to its extra nonce range
+func (s *Server) notify(sess *session, j *job, clean bool) {
+	s.mu.Lock()
+	extraNonceStart := sess.extraNonceStart
+	s.mu.Unlock()
+
+	notification := Job{
+		ID:            j.id,
+		BlockTemplate: *j.template,
+		ExtraNonceEnd: extraNonceStart + extraNonceRange,
+		CleanJobs:     clean,
+	}
+	notification.ExtraNonce = extraNonceStart
+
+	params, err := json.Marshal(notification)
+	if err != nil {
+		return
+	}
+
+	if err := sess.send(Request{Method: MethodNotify, Params: params}); err != nil {
+		log.Printf("Failed to notify miner %s: %v", sess.conn.RemoteAddr(), err)
+	}
+}
+
+// handleSession answers the requests of a miner until it disconnects
+func (s *Server) handleSession(sess *session) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.sessions, sess)
+		if worker, exists := s.workers[sess.worker]; exists {
+			worker.Sessions--
+		}
+		s.mu.Unlock()
+		sess.conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(sess.conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxLineSize)
+
+	for scanner.Scan() {
+		var request Request
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			log.Printf("Malformed request from miner %s: %v", sess.conn.RemoteAddr(), err)
+			return
+		}
+
+		result, err := s.handleRequest(sess, &request)
+
+		response := Response{ID: request.ID, Result: result}
+		if err != nil {
+			message := err.Error()
+			response.Error = &message
+		}
+
+		if err := sess.send(response); err != nil {
+			return
+		}
+
+		if s.tooManyRejected(sess) {
+			log.Printf("Disconnecting miner %s after %d rejected shares", sess.conn.RemoteAddr(), maxRejectedShares)
+			return
+		}
+
+		// Hand out the current job right after the subscription
+		if request.Method == MethodSubscribe && err == nil {
+			s.mu.Lock()
+			var current *job
+			if len(s.jobs) > 0 {
+				current = s.jobs[len(s.jobs)-1]
+			}
+			s.mu.Unlock()
+
+			if current != nil {
+				s.notify(sess, current, true)
+			}
+		}
+	}
+}
+
+// handleRequest handles a request of a miner
+func (s *Server) handleRequest(sess *session, request *Request) (interface{}, error) {
+	switch request.Method {
+	case MethodSubscribe:
+		return s.handleSubscribe(sess), nil
+	case MethodAuthorize:
+		var params AuthorizeParams
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			return nil, fmt.Errorf("invalid authorize parameters: %w", err)
+		}
+		return true, s.handleAuthorize(sess, params.Worker)
+	case MethodSubmit:
+		var params SubmitParams
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			return nil, fmt.Errorf("invalid submit parameters: %w", err)
+		}
+		return s.handleSubmit(sess, &params)
+	default:
+		return nil, fmt.Errorf("unknown method %q", request.Method)
+	}
+}
+
+// handleSubscribe assigns a distinct extra nonce range to the session
+func (s *Server) handleSubscribe(sess *session) SubscribeResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Ranges start after the extra nonces of the built-in miner
+	if !sess.subscribed {
+		s.nextExtraNonce++
+		sess.extraNonceStart = s.nextExtraNonce * extraNonceRange
+		sess.subscribed = true
+	}
+
+	return SubscribeResult{
+		ExtraNonceStart: sess.extraNonceStart,
+		ExtraNonceEnd:   sess.extraNonceStart + extraNonceRange,
+	}
+}
+
+// handleAuthorize credits the shares of the session to a worker
+func (s *Server) handleAuthorize(sess *session, worker string) error {
+	worker = strings.TrimSpace(worker)
+	if worker == "" {
+		return fmt.Errorf("worker name is empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sess.worker == worker {
+		return nil
+	}
+
+	stats, exists := s.workers[worker]
+	if !exists {
+		if len(s.workers) >= maxWorkers && !s.evictIdleWorker() {
+			return errTooManyWorkers
+		}
+		stats = &WorkerStats{Worker: worker}
+		s.workers[worker] = stats
+	}
+
+	if previous, exists := s.workers[sess.worker]; exists {
+		previous.Sessions--
+	}
+	stats.Sessions++
+	sess.worker = worker
+	return nil
+}
+
+// evictIdleWorker forgets the worker without session whose last share is the
+// oldest, returning false if every worker has a session (internal use,
+// requires the lock)
+func (s *Server) evictIdleWorker() bool {
+	var idle *WorkerStats
+	for _, worker := range s.workers {
+		if worker.Sessions == 0 && (idle == nil || worker.LastShare.Before(idle.LastShare)) {
+			idle = worker
+		}
+	}
+
+	if idle == nil {
+		return false
+	}
+	delete(s.workers, idle.Worker)
+	return true
+}
+
+// handleSubmit validates a share and submits it to the work source when it
+// also solves the block
+func (s *Server) handleSubmit(sess *session, params *SubmitParams) (*SubmitResult, error) {
+	s.mu.Lock()
+	if sess.worker == "" || !sess.subscribed {
+		s.mu.Unlock()
+		return nil, errUnauthorized
+	}
+	stats := s.workers[sess.worker]
+
+	block, current, key, err := s.checkShare(sess, params)
+	if err != nil {
+		s.rejectShare(sess, stats, err)
+		s.mu.Unlock()
+		return nil, err
+	}
+	s.mu.Unlock()
+
+	// Hash without holding the lock, so that the shares of other sessions
+	// are checked meanwhile. Jobs are never modified once created.
+	block.Hash = block.ComputeHash(current.pow)
+	solved := block.IsHashValid(block.Hash)
+
+	// Only accepted shares are recorded, the same share being possibly
+	// submitted twice while it was hashed
+	s.mu.Lock()
+	if !solved && !strings.HasPrefix(block.Hash, strings.Repeat("0", current.template.ShareDifficulty)) {
+		err = errLowDifficulty
+	} else if current.shares[key] {
+		err = errDuplicateShare
+	}
+	if err != nil {
+		s.rejectShare(sess, stats, err)
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	current.shares[key] = true
+	sess.rejected = 0
+	stats.Accepted++
+	stats.LastShare = time.Now()
+	s.mu.Unlock()
+
+	result := &SubmitResult{Hash: block.Hash}
+	if !solved {
+		return result, nil
+	}
+
+	// The share solves the block
+	if err := s.source.SubmitBlock(block); err != nil {
+		log.Printf("Block #%d found by pool worker %s was rejected: %v", block.Index, sess.worker, err)
+		return result, nil
+	}
+
+	s.mu.Lock()
+	stats.Blocks++
+	s.mu.Unlock()
+
+	log.Printf("Pool worker %s found block #%d (Hash: %s)", sess.worker, block.Index, block.Hash)
+	result.Block = true
+	return result, nil
+}
+
+// rejectShare counts a rejected share. Stale shares are expected after a tip
+// change and do not count towards disconnecting the session (internal use,
+// requires the lock).
+func (s *Server) rejectShare(sess *session, stats *WorkerStats, err error) {
+	if errors.Is(err, errStaleJob) {
+		stats.Stale++
+		return
+	}
+	stats.Rejected++
+	sess.rejected++
+}
+
+// tooManyRejected checks if the last shares of a session were all rejected
+func (s *Server) tooManyRejected(sess *session) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sess.rejected >= maxRejectedShares
+}
+
+// checkShare rebuilds the unhashed block of a share and checks it against its
+// job, returning the key under which the share is recorded once accepted
+// (internal use, requires the lock)
+func (s *Server) checkShare(sess *session, params *SubmitParams) (*blockchain.Block, *job, string, error) {
+	var current *job
+	for _, j := range s.jobs {
+		if j.id == params.JobID {
+			current = j
+		}
+	}
+
+	// Jobs are dropped when the tip changes
+	if current == nil {
+		return nil, nil, "", errStaleJob
+	}
+
+	if params.ExtraNonce < sess.extraNonceStart || params.ExtraNonce >= sess.extraNonceStart+extraNonceRange {
+		return nil, nil, "", fmt.Errorf("extra nonce %d is outside the range of the session", params.ExtraNonce)
+	}
+
+	if params.Timestamp < current.template.Timestamp || params.Timestamp > time.Now().Add(maxTimestampDrift).Unix() {
+		return nil, nil, "", fmt.Errorf("timestamp %d is out of range", params.Timestamp)
+	}
+
+	key := fmt.Sprintf("%d/%d/%d", params.Nonce, params.ExtraNonce, params.Timestamp)
+	if current.shares[key] {
+		return nil, nil, "", errDuplicateShare
+	}
+
+	block := current.template.Block()
+	block.Nonce = params.Nonce
+	block.ExtraNonce = params.ExtraNonce
+	block.Timestamp = params.Timestamp
+	return block, current, key, nil
+}
+
+// send writes a message on its own line
+func (sess *session) send(v interface{}) error {
+	sess.writeMu.Lock()
+	defer sess.writeMu.Unlock()
+
+	if err := sess.conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		return err
+	}
+	return sess.encoder.Encode(v)
+}
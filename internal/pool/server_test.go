@@ -0,0 +1,261 @@
+package pool
+
+import (
+	"blockchain-go/internal/blockchain"
+	"blockchain-go/internal/config"
+	"blockchain-go/internal/miner"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Every job and block is logged
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testSource hands out the same template and records the submitted blocks
+type testSource struct {
+	template miner.BlockTemplate
+
+	mu        sync.Mutex
+	submitted []*blockchain.Block
+}
+
+func newTestSource(difficulty int) *testSource {
+	block := blockchain.NewBlock(1, difficulty, difficulty, "data", "previous")
+	return &testSource{template: *miner.NewTemplateFromBlock(block)}
+}
+
+func (s *testSource) GetBlockTemplate() (*miner.BlockTemplate, error) {
+	template := s.template
+	return &template, nil
+}
+
+func (s *testSource) SubmitBlock(block *blockchain.Block) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.submitted = append(s.submitted, block)
+	return nil
+}
+
+// newTestServer returns a pool that is not listening, holding one job of the
+// source, and an authorized session
+func newTestServer(t *testing.T, source miner.WorkSource, shareDifficulty int) (*Server, *session) {
+	t.Helper()
+
+	cfg := config.Default().Pool
+	cfg.ShareDifficulty = shareDifficulty
+	s := NewServer(cfg, source)
+	s.refreshJob()
+
+	sess := &session{}
+	s.handleSubscribe(sess)
+	if err := s.handleAuthorize(sess, "alice"); err != nil {
+		t.Fatalf("failed to authorize worker: %v", err)
+	}
+	return s, sess
+}
+
+// findShare returns the parameters of a share of the current job whose hash
+// has exactly the given number of leading zeros
+func findShare(s *Server, sess *session, zeros int) *SubmitParams {
+	current := s.jobs[len(s.jobs)-1]
+	block := current.template.Block()
+	block.ExtraNonce = sess.extraNonceStart
+
+	for block.Nonce = 0; ; block.Nonce++ {
+		hash := block.ComputeHash(current.pow)
+		if strings.HasPrefix(hash, strings.Repeat("0", zeros)) && !strings.HasPrefix(hash, strings.Repeat("0", zeros+1)) {
+			return &SubmitParams{
+				JobID:      current.id,
+				Nonce:      block.Nonce,
+				ExtraNonce: block.ExtraNonce,
+				Timestamp:  block.Timestamp,
+			}
+		}
+	}
+}
+
+// workerStats returns the statistics of the only worker of a pool
+func workerStats(t *testing.T, s *Server) WorkerStats {
+	t.Helper()
+
+	stats := s.Stats()
+	if len(stats) != 1 {
+		t.Fatalf("pool holds %d workers, want 1", len(stats))
+	}
+	return stats[0]
+}
+
+func TestShareDifficultyBounds(t *testing.T) {
+	tests := []struct {
+		configured, difficulty, want int
+	}{
+		{0, 3, 1},
+		{-2, 3, 1},
+		{2, 3, 2},
+		{5, 3, 3},
+	}
+
+	for _, test := range tests {
+		s, _ := newTestServer(t, newTestSource(test.difficulty), test.configured)
+		if got := s.jobs[0].template.ShareDifficulty; got != test.want {
+			t.Errorf("share difficulty %d at block difficulty %d gave %d, want %d",
+				test.configured, test.difficulty, got, test.want)
+		}
+	}
+}
+
+func TestAcceptedAndDuplicateShares(t *testing.T) {
+	source := newTestSource(4)
+	s, sess := newTestServer(t, source, 1)
+
+	share := findShare(s, sess, 1)
+	result, err := s.handleSubmit(sess, share)
+	if err != nil {
+		t.Fatalf("valid share rejected: %v", err)
+	}
+	if result.Block || !strings.HasPrefix(result.Hash, "0") {
+		t.Fatalf("share result %+v, want a share that does not solve the block", result)
+	}
+
+	if _, err := s.handleSubmit(sess, share); !errors.Is(err, errDuplicateShare) {
+		t.Fatalf("share submitted twice returned %v, want %v", err, errDuplicateShare)
+	}
+
+	stats := workerStats(t, s)
+	if stats.Accepted != 1 || stats.Rejected != 1 || stats.Blocks != 0 {
+		t.Fatalf("worker stats %+v, want one accepted and one rejected share", stats)
+	}
+	if len(source.submitted) != 0 {
+		t.Fatal("share submitted as a block")
+	}
+}
+
+func TestLowDifficultyShare(t *testing.T) {
+	s, sess := newTestServer(t, newTestSource(4), 1)
+
+	// A rejected share is not recorded, so it is rejected for its difficulty again
+	share := findShare(s, sess, 0)
+	for i := 0; i < 2; i++ {
+		if _, err := s.handleSubmit(sess, share); !errors.Is(err, errLowDifficulty) {
+			t.Fatalf("share below the share difficulty returned %v, want %v", err, errLowDifficulty)
+		}
+	}
+
+	if stats := workerStats(t, s); stats.Accepted != 0 || stats.Rejected != 2 {
+		t.Fatalf("worker stats %+v, want two rejected shares", stats)
+	}
+}
+
+func TestStaleShare(t *testing.T) {
+	s, sess := newTestServer(t, newTestSource(4), 1)
+
+	share := findShare(s, sess, 1)
+	share.JobID = "unknown"
+	if _, err := s.handleSubmit(sess, share); !errors.Is(err, errStaleJob) {
+		t.Fatalf("share of an unknown job returned %v, want %v", err, errStaleJob)
+	}
+
+	if stats := workerStats(t, s); stats.Stale != 1 || stats.Rejected != 0 || sess.rejected != 0 {
+		t.Fatalf("worker stats %+v, want one stale share only", stats)
+	}
+}
+
+func TestShareSolvingBlock(t *testing.T) {
+	source := newTestSource(1)
+	s, sess := newTestServer(t, source, 1)
+
+	result, err := s.handleSubmit(sess, findShare(s, sess, 1))
+	if err != nil {
+		t.Fatalf("share solving the block rejected: %v", err)
+	}
+	if !result.Block || len(source.submitted) != 1 {
+		t.Fatal("share solving the block not submitted to the work source")
+	}
+	if stats := workerStats(t, s); stats.Accepted != 1 || stats.Blocks != 1 {
+		t.Fatalf("worker stats %+v, want one accepted share and one block", stats)
+	}
+}
+
+func TestRejectedSharesDisconnect(t *testing.T) {
+	s, _ := newTestServer(t, newTestSource(4), 1)
+
+	conn, poolConn := net.Pipe()
+	defer conn.Close()
+	sess := &session{conn: poolConn, encoder: json.NewEncoder(poolConn)}
+	if !s.trackSession(sess) {
+		t.Fatal("session refused")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer s.connections.Done()
+		s.handleSession(sess)
+		close(done)
+	}()
+
+	// Responses are read in the background, skipping job notifications
+	responses := make(chan *message)
+	go func() {
+		defer close(responses)
+		decoder := json.NewDecoder(conn)
+		for {
+			var msg message
+			if err := decoder.Decode(&msg); err != nil {
+				return
+			}
+			if msg.ID != nil {
+				responses <- &msg
+			}
+		}
+	}()
+
+	encoder := json.NewEncoder(conn)
+	call := func(id int64, method string, params interface{}) *message {
+		data, err := json.Marshal(params)
+		if err != nil {
+			t.Fatalf("failed to encode parameters: %v", err)
+		}
+		if err := encoder.Encode(Request{ID: &id, Method: method, Params: data}); err != nil {
+			return nil
+		}
+		return <-responses
+	}
+
+	call(1, MethodSubscribe, nil)
+	if response := call(2, MethodAuthorize, AuthorizeParams{Worker: "bob"}); response == nil || response.Error != nil {
+		t.Fatal("failed to authorize worker")
+	}
+
+	// Shares outside the extra nonce range of the session are all rejected
+	rejected := 0
+	for id := int64(3); id < 3+2*maxRejectedShares; id++ {
+		response := call(id, MethodSubmit, SubmitParams{JobID: s.jobs[0].id})
+		if response == nil {
+			break
+		}
+		if response.Error == nil {
+			t.Fatal("share outside the extra nonce range accepted")
+		}
+		rejected++
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("session still open after repeated rejected shares")
+	}
+	if rejected != maxRejectedShares {
+		t.Fatalf("session closed after %d rejected shares, want %d", rejected, maxRejectedShares)
+	}
+}
@@ -0,0 +1,67 @@
+package simulator
+
+import (
+	"sync"
+	"time"
+)
+
+// clockWaiter is a goroutine sleeping until a virtual deadline
+type clockWaiter struct {
+	deadline time.Time
+	wake     chan struct{}
+}
+
+// Clock is a virtual clock only advanced by the simulation
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*clockWaiter
+}
+
+// NewClock creates a virtual clock starting at the given time
+func NewClock(start time.Time) *Clock {
+	return &Clock{
+		now:     start,
+		waiters: make([]*clockWaiter, 0),
+	}
+}
+
+// Now returns the current virtual time
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel closed once the virtual clock has advanced by d
+func (c *Clock) After(d time.Duration) <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	waiter := &clockWaiter{deadline: c.now.Add(d), wake: make(chan struct{})}
+	if d <= 0 {
+		close(waiter.wake)
+		return waiter.wake
+	}
+
+	c.waiters = append(c.waiters, waiter)
+	return waiter.wake
+}
+
+// Advance moves the virtual clock forward and wakes the due waiters
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	waiters := c.waiters[:0]
+	for _, waiter := range c.waiters {
+		if waiter.deadline.After(c.now) {
+			waiters = append(waiters, waiter)
+			continue
+		}
+		close(waiter.wake)
+	}
+	c.waiters = waiters
+}
@@ -0,0 +1,161 @@
+package simulator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NodeReport holds the final state of a simulated node
+type NodeReport struct {
+	ID          int
+	Host        string
+	Joined      bool
+	Crashed     bool
+	Selfish     bool
+	Height      int
+	TipHash     string
+	BlocksMined int
+	// BlocksKept is the number of blocks mined by the node that are part of the reference chain
+	BlocksKept int
+	ChainError error
+}
+
+// Report holds the outcome of a simulation
+type Report struct {
+	Nodes           []NodeReport
+	BlocksMined     int
+	OrphanedBlocks  int
+	Height          int
+	Converged       bool
+	ConvergenceTime time.Duration
+}
+
+// report builds the simulation report, using the chain of the first running
+// node as the reference chain
+func (s *Simulation) report(converged bool, convergenceTime time.Duration) *Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := &Report{
+		Nodes:           make([]NodeReport, 0, len(s.nodes)),
+		BlocksMined:     len(s.mined),
+		Converged:       converged,
+		ConvergenceTime: convergenceTime,
+	}
+
+	// Blocks of the reference chain
+	kept := make(map[string]bool)
+	for _, node := range s.nodes {
+		if !node.joined || node.crashed {
+			continue
+		}
+
+		blocks, err := node.blockchain.GetBlocks(0, node.blockchain.GetChainLength()-1)
+		if err != nil {
+			continue
+		}
+
+		for _, block := range blocks {
+			kept[block.Hash] = true
+		}
+		report.Height = len(blocks) - 1
+		break
+	}
+
+	for hash := range s.mined {
+		if !kept[hash] {
+			report.OrphanedBlocks++
+		}
+	}
+
+	for _, node := range s.nodes {
+		nodeReport := NodeReport{
+			ID:          node.ID,
+			Host:        node.Host,
+			Joined:      node.joined,
+			Crashed:     node.crashed,
+			Selfish:     node.Spec.Selfish,
+			Height:      -1,
+			BlocksMined: node.mined,
+		}
+
+		if node.blockchain != nil {
+			if tip, err := node.blockchain.GetLatestBlock(); err == nil {
+				nodeReport.Height = tip.Index
+				nodeReport.TipHash = tip.Hash
+			}
+			nodeReport.ChainError = node.blockchain.IsValid()
+
+			blocks, _ := node.blockchain.GetBlocks(0, node.blockchain.GetChainLength()-1)
+			for _, block := range blocks {
+				if block.Data == node.Host && kept[block.Hash] {
+					nodeReport.BlocksKept++
+				}
+			}
+		}
+
+		report.Nodes = append(report.Nodes, nodeReport)
+	}
+
+	return report
+}
+
+// AssertConvergence returns an error if the running nodes do not share the
+// same valid chain at the end of the simulation
+func (r *Report) AssertConvergence() error {
+	if !r.Converged {
+		return fmt.Errorf("nodes did not converge on a common tip")
+	}
+
+	for _, node := range r.Nodes {
+		if node.Crashed {
+			continue
+		}
+
+		if !node.Joined {
+			return fmt.Errorf("node %d never joined the network", node.ID)
+		}
+
+		if node.ChainError != nil {
+			return fmt.Errorf("node %d holds an invalid chain: %w", node.ID, node.ChainError)
+		}
+	}
+
+	return nil
+}
+
+// String returns a human readable summary of the report
+func (r *Report) String() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "Converged: %t", r.Converged)
+	if r.Converged {
+		fmt.Fprintf(&sb, " (after %s of settling)", r.ConvergenceTime)
+	}
+	fmt.Fprintf(&sb, "\nHeight: %d, blocks mined: %d, orphaned: %d\n", r.Height, r.BlocksMined, r.OrphanedBlocks)
+
+	for _, node := range r.Nodes {
+		state := "running"
+		switch {
+		case node.Crashed:
+			state = "crashed"
+		case !node.Joined:
+			state = "not joined"
+		}
+
+		role := "honest"
+		if node.Selfish {
+			role = "selfish"
+		}
+
+		fmt.Fprintf(&sb, "  %s [%s, %s] height %d, mined %d, kept %d",
+			node.Host, role, state, node.Height, node.BlocksMined, node.BlocksKept)
+		if node.ChainError != nil {
+			fmt.Fprintf(&sb, ", invalid chain: %v", node.ChainError)
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
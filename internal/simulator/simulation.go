@@ -0,0 +1,550 @@
+package simulator
+
+import (
+	"blockchain-go/internal/blockchain"
+	"blockchain-go/internal/config"
+	"blockchain-go/internal/miner"
+	"blockchain-go/internal/network"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// nodePort is the port of every simulated node, nodes are told apart by host
+	nodePort = 1
+
+	// settlePoll is the real-time interval between two network activity checks
+	settlePoll = 500 * time.Microsecond
+
+	// settleChecks is the number of checks without activity after which the
+	// network is considered settled
+	settleChecks = 5
+
+	// maxSettleWait is the maximum real time spent waiting for the network to settle
+	maxSettleWait = 2 * time.Second
+)
+
+// Config holds the parameters of a simulation
+type Config struct {
+	Seed            int64
+	Tick            time.Duration
+	Duration        time.Duration
+	SettleDuration  time.Duration
+	TargetBlockTime time.Duration
+	Latency         time.Duration
+	LatencyJitter   time.Duration
+	PacketLoss      float64
+	Degree          int
+}
+
+// DefaultConfig returns the default simulation parameters
+func DefaultConfig() Config {
+	return Config{
+		Seed:            1,
+		Tick:            time.Second,
+		Duration:        10 * time.Minute,
+		SettleDuration:  5 * time.Minute,
+		TargetBlockTime: 20 * time.Second,
+		Latency:         200 * time.Millisecond,
+		LatencyJitter:   100 * time.Millisecond,
+		PacketLoss:      0,
+		Degree:          3,
+	}
+}
+
+// NodeSpec describes a simulated node
+type NodeSpec struct {
+	// HashPower is the share of the network hash rate of the node, relative to the other nodes
+	HashPower float64
+	// Selfish nodes withhold their blocks and publish them only to override the honest chain
+	Selfish bool
+	// JoinAt is the virtual time at which the node joins the network
+	JoinAt time.Duration
+}
+
+// Node is a simulated node
+type Node struct {
+	ID         int
+	Host       string
+	Spec       NodeSpec
+	manager    *network.Manager
+	blockchain *blockchain.Blockchain
+	joined     bool
+	joining    bool
+	crashed    bool
+	published  int
+	mined      int
+}
+
+// event is an action scheduled at a virtual time
+type event struct {
+	at     time.Duration
+	name   string
+	action func(*Simulation)
+}
+
+// Simulation runs several nodes on an in-memory network driven by a virtual clock
+type Simulation struct {
+	mu        sync.Mutex
+	config    Config
+	clock     *Clock
+	network   *network.MemoryNetwork
+	rand      *rand.Rand
+	nodes     []*Node
+	events    []event
+	partition map[string]int
+	mined     map[string]bool
+	activity  int64
+	elapsed   time.Duration
+}
+
+// New creates a simulation of the given nodes. The first node creates the
+// genesis block and must join at time zero.
+func New(cfg Config, specs []NodeSpec) (*Simulation, error) {
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("simulation needs at least one node")
+	}
+
+	if specs[0].JoinAt != 0 {
+		return nil, fmt.Errorf("the first node must join at time zero")
+	}
+
+	if cfg.Tick <= 0 || cfg.TargetBlockTime <= 0 {
+		return nil, fmt.Errorf("tick and target block time must be positive")
+	}
+
+	sim := &Simulation{
+		config:    cfg,
+		clock:     NewClock(time.Now()),
+		network:   network.NewMemoryNetwork(),
+		rand:      rand.New(rand.NewSource(cfg.Seed)),
+		nodes:     make([]*Node, len(specs)),
+		events:    make([]event, 0),
+		partition: make(map[string]int),
+		mined:     make(map[string]bool),
+	}
+
+	for i, spec := range specs {
+		sim.nodes[i] = &Node{
+			ID:   i,
+			Host: fmt.Sprintf("node-%d", i),
+			Spec: spec,
+		}
+	}
+
+	return sim, nil
+}
+
+// Schedule runs an action at the given virtual time of the mining phase
+func (s *Simulation) Schedule(at time.Duration, name string, action func(*Simulation)) {
+	s.events = append(s.events, event{at: at, name: name, action: action})
+	sort.SliceStable(s.events, func(i, j int) bool {
+		return s.events[i].at < s.events[j].at
+	})
+}
+
+// Partition splits the network into groups of node IDs that cannot reach each
+// other. Nodes not listed are put in the first group.
+func (s *Simulation) Partition(groups ...[]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.partition = make(map[string]int)
+	for i, group := range groups {
+		for _, id := range group {
+			s.partition[s.nodes[id].Host] = i
+		}
+	}
+}
+
+// Heal removes every network partition
+func (s *Simulation) Heal() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.partition = make(map[string]int)
+}
+
+// Crash stops a node from mining and disconnects it from the network
+func (s *Simulation) Crash(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nodes[id].crashed = true
+}
+
+// Recover reconnects a crashed node, which catches up from new announcements
+func (s *Simulation) Recover(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nodes[id].crashed = false
+}
+
+// Nodes returns the simulated nodes
+func (s *Simulation) Nodes() []*Node {
+	return s.nodes
+}
+
+// Run runs the mining phase, then heals every fault and keeps honest mining
+// until the nodes converge or the settle duration elapses
+func (s *Simulation) Run() (*Report, error) {
+	s.startGenesisNode()
+
+	// Mining phase with fault injection
+	for s.elapsed = 0; s.elapsed < s.config.Duration; s.elapsed += s.config.Tick {
+		s.fireEvents()
+		s.step(false)
+	}
+
+	// Convergence phase: every fault is lifted and selfish nodes publish their blocks
+	s.Heal()
+	for _, node := range s.nodes {
+		s.Recover(node.ID)
+	}
+	s.publishWithheld(true)
+
+	var convergedAfter time.Duration
+	converged := false
+	for settled := time.Duration(0); settled < s.config.SettleDuration; settled += s.config.Tick {
+		s.step(true)
+
+		if s.converged() {
+			converged = true
+			convergedAfter = settled
+			break
+		}
+	}
+
+	return s.report(converged, convergedAfter), nil
+}
+
+// startGenesisNode creates the genesis block on the first node and starts it
+func (s *Simulation) startGenesisNode() {
+	node := s.nodes[0]
+	s.createNode(node, nil)
+	node.blockchain.CreateGenesisBlock()
+
+	s.mu.Lock()
+	node.joined = true
+	s.mu.Unlock()
+
+	s.settle()
+}
+
+// createNode creates the blockchain and network manager of a node
+func (s *Simulation) createNode(node *Node, seeds []string) {
+	cfg := config.Default()
+	cfg.Network.Host = node.Host
+	cfg.Network.Port = nodePort
+	cfg.Network.BanFile = ""
+	cfg.Network.IdentityFile = ""
+	cfg.Network.MaxPeerFailures = 0
+	cfg.Network.SeedPeers = seeds
+
+	transport := &faultTransport{
+		sim:   s,
+		host:  node.Host,
+		inner: s.network.Transport(node.Host),
+	}
+
+	node.blockchain = blockchain.New(cfg.Blockchain.DifficultyCalculationBlocks, int(s.config.TargetBlockTime/time.Second))
+	node.manager = network.NewManagerWithTransport(cfg.Network, node.blockchain, transport)
+	go node.manager.StartServer()
+}
+
+// step runs a single tick: joins, mining, block publication and message delivery
+func (s *Simulation) step(honest bool) {
+	s.startJoins()
+	s.mine(honest)
+	if !honest {
+		s.publishWithheld(false)
+	}
+
+	s.settle()
+	s.clock.Advance(s.config.Tick)
+	s.settle()
+}
+
+// fireEvents runs the events due at the current virtual time
+func (s *Simulation) fireEvents() {
+	for len(s.events) > 0 && s.events[0].at <= s.elapsed {
+		s.events[0].action(s)
+		s.events = s.events[1:]
+	}
+}
+
+// startJoins makes the nodes due to join connect to random joined nodes
+func (s *Simulation) startJoins() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, node := range s.nodes {
+		if node.joined || node.joining || node.crashed || node.Spec.JoinAt > s.elapsed {
+			continue
+		}
+
+		targets := s.pickJoinedNodes(node, s.config.Degree)
+		if len(targets) == 0 {
+			continue
+		}
+
+		if node.manager == nil {
+			seeds := make([]string, 0, len(targets)-1)
+			for _, target := range targets[1:] {
+				seeds = append(seeds, fmt.Sprintf("%s:%d", target.Host, nodePort))
+			}
+			s.createNode(node, seeds)
+		}
+
+		node.joining = true
+		go func(n *Node, initHost string) {
+			err := n.manager.Join(initHost, nodePort)
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			n.joining = false
+			if err != nil {
+				// Retry from scratch at the next tick
+				n.blockchain.Reset()
+				return
+			}
+			n.joined = true
+		}(node, targets[0].Host)
+	}
+}
+
+// pickJoinedNodes returns up to count random joined and running nodes (locked by caller)
+func (s *Simulation) pickJoinedNodes(exclude *Node, count int) []*Node {
+	candidates := make([]*Node, 0, len(s.nodes))
+	for _, node := range s.nodes {
+		if node != exclude && node.joined && !node.crashed {
+			candidates = append(candidates, node)
+		}
+	}
+
+	s.rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	if count < 1 {
+		count = 1
+	}
+	if len(candidates) > count {
+		candidates = candidates[:count]
+	}
+	return candidates
+}
+
+// mine runs the mining lottery of the tick, each node finding a block with a
+// probability proportional to its hash power
+func (s *Simulation) mine(honest bool) {
+	s.mu.Lock()
+	totalPower := 0.0
+	for _, node := range s.nodes {
+		totalPower += node.Spec.HashPower
+	}
+
+	winners := make([]*Node, 0)
+	for _, node := range s.nodes {
+		if !node.joined || node.crashed || totalPower <= 0 {
+			continue
+		}
+
+		probability := node.Spec.HashPower / totalPower * float64(s.config.Tick) / float64(s.config.TargetBlockTime)
+		if s.rand.Float64() < probability {
+			winners = append(winners, node)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, node := range winners {
+		block, err := s.mineBlock(node)
+		if err != nil {
+			continue
+		}
+
+		if !node.Spec.Selfish || honest {
+			s.announce(node, block)
+		}
+	}
+}
+
+// mineBlock solves a block on top of the node's chain, timestamped with the virtual clock
+func (s *Simulation) mineBlock(node *Node) (*blockchain.Block, error) {
+	block, err := miner.NewBlockTemplate(node.blockchain, node.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	block.Timestamp = s.clock.Now().Unix()
+	pow := node.blockchain.GetPoW()
+	for block.Hash = block.ComputeHash(pow); !block.IsHashValid(block.Hash); block.Hash = block.ComputeHash(pow) {
+		block.Nonce++
+	}
+
+	if err := node.blockchain.AddBlock(block); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.mined[block.Hash] = true
+	node.mined++
+	s.mu.Unlock()
+
+	return block, nil
+}
+
+// announce publishes the tip of a node to its peers
+func (s *Simulation) announce(node *Node, block *blockchain.Block) {
+	if err := node.manager.AnnounceBlock(block); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	node.published = block.Index
+	s.mu.Unlock()
+}
+
+// nodeState is a snapshot of the fields of a node shared with the join goroutines
+type nodeState struct {
+	node       *Node
+	blockchain *blockchain.Blockchain
+	joined     bool
+	crashed    bool
+	published  int
+}
+
+// nodeStates returns a snapshot of every node, so that their chains can be
+// read without holding the lock
+func (s *Simulation) nodeStates() []nodeState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make([]nodeState, len(s.nodes))
+	for i, node := range s.nodes {
+		states[i] = nodeState{
+			node:       node,
+			blockchain: node.blockchain,
+			joined:     node.joined,
+			crashed:    node.crashed,
+			published:  node.published,
+		}
+	}
+	return states
+}
+
+// publishWithheld publishes the private chain of selfish nodes when the honest
+// chain is about to catch up, or unconditionally when force is set
+func (s *Simulation) publishWithheld(force bool) {
+	states := s.nodeStates()
+
+	publicHeight := 0
+	for _, state := range states {
+		if state.joined && !state.node.Spec.Selfish {
+			if length := state.blockchain.GetChainLength(); length-1 > publicHeight {
+				publicHeight = length - 1
+			}
+		}
+	}
+
+	for _, state := range states {
+		if !state.node.Spec.Selfish || !state.joined || state.crashed {
+			continue
+		}
+
+		tip, err := state.blockchain.GetLatestBlock()
+		if err != nil || tip.Index <= state.published {
+			continue
+		}
+
+		if force || tip.Index-publicHeight <= 1 {
+			s.announce(state.node, tip)
+		}
+	}
+}
+
+// converged checks if every running node has joined and shares the same tip
+func (s *Simulation) converged() bool {
+	tipHash := ""
+	for _, state := range s.nodeStates() {
+		if state.crashed {
+			continue
+		}
+
+		if !state.joined {
+			return false
+		}
+
+		tip, err := state.blockchain.GetLatestBlock()
+		if err != nil {
+			return false
+		}
+
+		if tipHash == "" {
+			tipHash = tip.Hash
+		} else if tip.Hash != tipHash {
+			return false
+		}
+	}
+	return true
+}
+
+// settle waits in real time until no connection has been opened or closed for
+// a few checks, meaning every in-flight message is delivered or waiting on the clock
+func (s *Simulation) settle() {
+	deadline := time.Now().Add(maxSettleWait)
+	last := atomic.LoadInt64(&s.activity)
+
+	for stable := 0; stable < settleChecks && time.Now().Before(deadline); {
+		time.Sleep(settlePoll)
+
+		current := atomic.LoadInt64(&s.activity)
+		if current == last {
+			stable++
+			continue
+		}
+
+		stable = 0
+		last = current
+	}
+}
+
+// checkLink returns an error if messages cannot travel between two hosts
+func (s *Simulation) checkLink(from, to string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, node := range s.nodes {
+		if (node.Host == from || node.Host == to) && node.crashed {
+			return fmt.Errorf("node %s is down", node.Host)
+		}
+	}
+
+	if s.partition[from] != s.partition[to] {
+		return fmt.Errorf("%s and %s are partitioned", from, to)
+	}
+
+	return nil
+}
+
+// dropPacket decides if a message is lost
+func (s *Simulation) dropPacket() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.config.PacketLoss > 0 && s.rand.Float64() < s.config.PacketLoss
+}
+
+// latency returns the delivery delay of a message
+func (s *Simulation) latency() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	latency := s.config.Latency
+	if s.config.LatencyJitter > 0 {
+		latency += time.Duration(s.rand.Int63n(int64(2*s.config.LatencyJitter))) - s.config.LatencyJitter
+	}
+	return latency
+}
@@ -0,0 +1,118 @@
+package simulator
+
+import (
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// The nodes log every message they exchange
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testConfig returns a short simulation with frequent blocks
+func testConfig() Config {
+	cfg := DefaultConfig()
+	cfg.Duration = 4 * time.Minute
+	cfg.SettleDuration = 5 * time.Minute
+	cfg.TargetBlockTime = 10 * time.Second
+	return cfg
+}
+
+// honestSpecs returns the specs of count honest nodes of equal hash power
+func honestSpecs(count int) []NodeSpec {
+	specs := make([]NodeSpec, count)
+	for i := range specs {
+		specs[i] = NodeSpec{HashPower: 1}
+	}
+	return specs
+}
+
+// runSimulation runs a simulation and fails the test unless the nodes converge
+func runSimulation(t *testing.T, sim *Simulation) *Report {
+	t.Helper()
+
+	report, err := sim.Run()
+	if err != nil {
+		t.Fatalf("simulation failed: %v", err)
+	}
+
+	if err := report.AssertConvergence(); err != nil {
+		t.Fatalf("%v\n%s", err, report)
+	}
+	return report
+}
+
+func TestSimulationForks(t *testing.T) {
+	// Blocks found faster than they propagate make nodes mine competing branches
+	cfg := testConfig()
+	cfg.TargetBlockTime = 5 * time.Second
+	cfg.Latency = time.Second
+	cfg.LatencyJitter = 500 * time.Millisecond
+
+	sim, err := New(cfg, honestSpecs(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := runSimulation(t, sim)
+	t.Logf("height %d with %d orphaned blocks", report.Height, report.OrphanedBlocks)
+}
+
+func TestSimulationSelfishMiner(t *testing.T) {
+	specs := honestSpecs(4)
+	specs[1] = NodeSpec{HashPower: 1.5, Selfish: true}
+
+	sim, err := New(testConfig(), specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runSimulation(t, sim)
+}
+
+func TestSimulationPartition(t *testing.T) {
+	cfg := testConfig()
+	sim, err := New(cfg, honestSpecs(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sim.Schedule(cfg.Duration/4, "partition", func(s *Simulation) { s.Partition([]int{0, 1}, []int{2, 3}) })
+	sim.Schedule(cfg.Duration/2, "heal", func(s *Simulation) { s.Heal() })
+
+	runSimulation(t, sim)
+}
+
+func TestSimulationLateJoin(t *testing.T) {
+	cfg := testConfig()
+	specs := honestSpecs(4)
+	specs[3].JoinAt = cfg.Duration / 2
+
+	sim, err := New(cfg, specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := runSimulation(t, sim)
+	if late := report.Nodes[3]; late.Height != report.Height {
+		t.Fatalf("late node at height %d, want %d", late.Height, report.Height)
+	}
+}
+
+func TestSimulationCrash(t *testing.T) {
+	cfg := testConfig()
+	sim, err := New(cfg, honestSpecs(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sim.Schedule(cfg.Duration/4, "crash", func(s *Simulation) { s.Crash(3) })
+	sim.Schedule(cfg.Duration/2, "recover", func(s *Simulation) { s.Recover(3) })
+
+	runSimulation(t, sim)
+}
@@ -0,0 +1,68 @@
+package simulator
+
+import (
+	"blockchain-go/internal/network"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// faultTransport injects latency, packet loss, partitions and crashes into
+// the in-memory transport of a simulated node
+type faultTransport struct {
+	sim   *Simulation
+	host  string
+	inner network.Transport
+}
+
+// Listen listens on the in-memory network
+func (ft *faultTransport) Listen(address string) (net.Listener, error) {
+	return ft.inner.Listen(address)
+}
+
+// Dial connects to another node once the simulated latency has elapsed on
+// the virtual clock, unless the connection is dropped by an injected fault
+func (ft *faultTransport) Dial(address string, timeout time.Duration) (net.Conn, error) {
+	target, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %s: %w", address, err)
+	}
+
+	if err := ft.sim.checkLink(ft.host, target); err != nil {
+		return nil, err
+	}
+
+	if ft.sim.dropPacket() {
+		return nil, fmt.Errorf("dial %s: packet lost", address)
+	}
+
+	// Wait for the message to travel on the virtual clock
+	<-ft.sim.clock.After(ft.sim.latency())
+
+	// The link may have been cut while the message was in flight
+	if err := ft.sim.checkLink(ft.host, target); err != nil {
+		return nil, err
+	}
+
+	atomic.AddInt64(&ft.sim.activity, 1)
+	conn, err := ft.inner.Dial(address, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &trackedConn{Conn: conn, sim: ft.sim}, nil
+}
+
+// trackedConn records network activity when it is closed, so that the
+// simulation can tell when the nodes have settled
+type trackedConn struct {
+	net.Conn
+	sim *Simulation
+}
+
+// Close closes the connection and records the activity
+func (tc *trackedConn) Close() error {
+	atomic.AddInt64(&tc.sim.activity, 1)
+	return tc.Conn.Close()
+}